@@ -0,0 +1,91 @@
+// pbjson 在命令行中将PB或者JCE二进制数据转换为json
+//
+// 用法:
+//
+//	pbjson [--opts options.json] [--format hex|base64|raw] [--jce] [file]
+//
+// 没有指定文件时从标准输入读取数据，转换结果输出到标准输出，失败时输出错误并以非0状态退出
+// PB数据的结果以缩进的json输出，标准输出为终端且没有设置NO_COLOR时使用颜色
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"pb_json/jce"
+	"pb_json/pb"
+)
+
+var (
+	// errInvalidOptions 选择文件不是合法的json
+	errInvalidOptions = errors.New("invalid options file")
+	// errUnknownFormat 未知的输入编码
+	errUnknownFormat = errors.New("unknown input format")
+)
+
+func main() {
+	optsFile := flag.String("opts", "", "options json file")
+	format := flag.String("format", "raw", "input encoding: hex, base64 or raw")
+	useJCE := flag.Bool("jce", false, "decode input as jce instead of pb")
+	flag.Parse()
+
+	if err := run(os.Stdout, flag.Arg(0), *optsFile, *format, *useJCE); err != nil {
+		fmt.Fprintln(os.Stderr, "pbjson:", err)
+		os.Exit(1)
+	}
+}
+
+// run 读取输入和选择并将转换结果输出到w
+// input: 输入文件，为空时从标准输入读取
+func run(w *os.File, input, optsFile, format string, useJCE bool) error {
+	var opts pb.Options
+	if optsFile != "" {
+		data, err := os.ReadFile(optsFile)
+		if err != nil {
+			return err
+		}
+		if opts = pb.NewOptions(data); opts == nil {
+			return fmt.Errorf("%w: %s", errInvalidOptions, optsFile)
+		}
+	}
+
+	var data []byte
+	var err error
+	if input == "" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(input)
+	}
+	if err != nil {
+		return err
+	}
+	if data, err = decodeInput(data, format); err != nil {
+		return err
+	}
+
+	if useJCE {
+		js, err := jce.Decode(data, opts)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, js)
+		return err
+	}
+	return pb.DecodeColor(w, data, opts, pb.ColorEnabled(w))
+}
+
+// decodeInput 根据输入的编码得到二进制数据，hex和base64忽略空白，hex可以带0x前缀
+func decodeInput(data []byte, format string) ([]byte, error) {
+	switch format {
+	case "raw":
+		return data, nil
+	case "hex":
+		return pb.ParseHex(string(data))
+	case "base64":
+		return pb.ParseBase64(string(data))
+	}
+	return nil, fmt.Errorf("%w: %s", errUnknownFormat, format)
+}
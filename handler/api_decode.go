@@ -1,35 +1,92 @@
 package handler
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
 
 	"pb_json/pb"
 
-	"github.com/gogf/gf/v2/frame/g"
 	"github.com/gogf/gf/v2/net/ghttp"
 )
 
+// emptyResult 空数据的解析结果
+const emptyResult = "{}"
+
+// Stream中data的编码方式
+const (
+	// EncodingBase64 标准base64编码，encoding为空时的默认值
+	EncodingBase64 = "base64"
+	// EncodingHex 十六进制编码
+	EncodingHex = "hex"
+	// EncodingRaw data字符串本身就是PB数据
+	EncodingRaw = "raw"
+)
+
+var (
+	errUnknownEncoding = errors.New("unknown data encoding")
+)
+
 type Stream struct {
 	Type string `json:"type"`
-	Data []byte `json:"data"`
+	// Data PB数据，按照Encoding编码
+	Data string `json:"data"`
+	// Encoding Data的编码方式，为空时为base64
+	Encoding string `json:"encoding"`
+}
+
+// apiErrorResponse 解析失败时的响应
+type apiErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// bytes 按照Encoding解码Data
+func (s *Stream) bytes() ([]byte, error) {
+	switch s.Encoding {
+	case "", EncodingBase64:
+		return base64.StdEncoding.DecodeString(s.Data)
+	case EncodingHex:
+		return hex.DecodeString(s.Data)
+	case EncodingRaw:
+		return []byte(s.Data), nil
+	}
+	return nil, fmt.Errorf("%w: %q", errUnknownEncoding, s.Encoding)
 }
 
 func ApiDecode(r *ghttp.Request) {
 	data, _ := io.ReadAll(r.Body)
 	r.Response.Header().Set("Content-Type", "application/json")
+	// 空请求体(如健康检查)直接返回空对象
+	if len(data) == 0 {
+		r.Response.Write(emptyResult)
+		return
+	}
 	var stream *Stream
 	if err := json.Unmarshal(data, &stream); err != nil {
-		g.Log().Infof(nil, "decode err")
-		r.Response.Write(data)
+		logResult(r.Context(), "api_decode", len(data), 0, err)
+		writeJSON(r, http.StatusBadRequest, apiErrorResponse{Error: err.Error()})
+		return
+	}
+	if stream == nil || len(stream.Data) == 0 {
+		r.Response.Write(emptyResult)
+		return
+	}
+	raw, err := stream.bytes()
+	if err != nil {
+		logResult(r.Context(), "api_decode", len(data), 0, err)
+		writeJSON(r, http.StatusBadRequest, apiErrorResponse{Error: "invalid data: " + err.Error()})
 		return
 	}
-	js, err := pb.Decode(stream.Data, nil)
+	js, err := pb.DecodeContext(r.Context(), raw, nil)
 	if err != nil {
-		g.Log().Errorf(nil, "decode err: %v", err)
-		r.Response.Write(data)
+		logResult(r.Context(), "api_decode", len(data), 0, err)
+		writeJSON(r, http.StatusBadRequest, apiErrorResponse{Error: err.Error()})
 		return
 	}
-	g.Log().Infof(nil, "data -> result: %v -> %v", len(data), len(js))
+	logResult(r.Context(), "api_decode", len(data), len(js), nil)
 	r.Response.Write(js)
 }
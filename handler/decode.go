@@ -1,24 +1,75 @@
 package handler
 
 import (
+	"errors"
 	"io"
 	"net/http"
 
 	"pb_json/pb"
 
-	"github.com/gogf/gf/v2/frame/g"
 	"github.com/gogf/gf/v2/net/ghttp"
 )
 
+// OptionsHeader 传递解析选择的http头，也可以通过opts查询参数传递，内容为选择的json
+const OptionsHeader = "X-PB-Options"
+
+var (
+	errInvalidOptions = errors.New("invalid options")
+)
+
+// requestOptions 获取请求中的解析选择，查询参数opts优先于X-PB-Options头，都没有时返回nil
+func requestOptions(r *ghttp.Request) (pb.Options, error) {
+	data := r.URL.Query().Get("opts")
+	if data == "" {
+		data = r.Header.Get(OptionsHeader)
+	}
+	if data == "" {
+		return nil, nil
+	}
+	opts := pb.NewOptions([]byte(data))
+	if opts == nil {
+		return nil, errInvalidOptions
+	}
+	return opts, nil
+}
+
+// countingReader 统计读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+// Read 读取数据并累加字节数
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// Decode 将请求体中的PB二进制数据反序列化为json数据，解析选择通过opts查询参数或者X-PB-Options头传递
 func Decode(r *ghttp.Request) {
-	data, _ := io.ReadAll(r.Body)
+	r.Response.Header().Set("Content-Type", "application/json")
+	opts, err := requestOptions(r)
+	if err != nil {
+		logResult(r.Context(), "decode", 0, 0, err)
+		writeJSON(r, http.StatusBadRequest, apiErrorResponse{Error: err.Error()})
+		return
+	}
+	// 逐个字段读取请求体进行解析，避免大的请求体整个读入内存，客户端断开时停止解析
+	body := &countingReader{r: r.Body}
 	// 这里需要转换下数据结构 相当于 需要转换成其他的类型
-	js, err := pb.Decode(data, nil)
+	js, err := pb.DecodeReaderContext(r.Context(), body, opts)
+	// 空请求体(如健康检查)直接返回空对象，读取失败时按照错误处理
+	if err == nil && body.n == 0 {
+		logResult(r.Context(), "decode", 0, len(emptyResult), nil)
+		r.Response.Write(emptyResult)
+		return
+	}
 	if err != nil {
-		g.Log().Infof(nil, "decode err")
-		r.Response.WriteStatus(http.StatusBadRequest)
+		logResult(r.Context(), "decode", body.n, 0, err)
+		writeJSON(r, http.StatusBadRequest, apiErrorResponse{Error: err.Error()})
 		return
 	}
-	g.Log().Infof(nil, "data -> result: %v -> %v", len(data), len(js))
+	logResult(r.Context(), "decode", body.n, len(js), nil)
 	r.Response.Write(js)
 }
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"pb_json/pb"
+
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// DiffRequest /diff的请求，a和b为base64编码的PB数据
+type DiffRequest struct {
+	A       []byte     `json:"a"`
+	B       []byte     `json:"b"`
+	Options pb.Options `json:"options"`
+}
+
+// diffResponse /diff的响应
+type diffResponse struct {
+	Changes []pb.Change `json:"changes"`
+}
+
+// diffErrorResponse /diff解析失败的响应，errors中为每一方的错误
+type diffErrorResponse struct {
+	Errors map[string]string `json:"errors"`
+}
+
+// Diff 使用相同的选择解析两份PB数据，返回字段级别的差异
+func Diff(r *ghttp.Request) {
+	data, _ := io.ReadAll(r.Body)
+	r.Response.Header().Set("Content-Type", "application/json")
+	var req DiffRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		logResult(r.Context(), "diff", len(data), 0, err)
+		writeJSON(r, http.StatusBadRequest, diffErrorResponse{Errors: map[string]string{"request": err.Error()}})
+		return
+	}
+
+	// 分别解析两方，两方都失败时一起返回
+	errs := map[string]string{}
+	pathsA, err := pb.DecodeWithPaths(req.A, req.Options)
+	if err != nil {
+		errs["a"] = err.Error()
+	}
+	pathsB, err := pb.DecodeWithPaths(req.B, req.Options)
+	if err != nil {
+		errs["b"] = err.Error()
+	}
+	if len(errs) > 0 {
+		logResult(r.Context(), "diff", len(data), 0, fmt.Errorf("%v", errs))
+		writeJSON(r, http.StatusBadRequest, diffErrorResponse{Errors: errs})
+		return
+	}
+
+	changes := pb.DiffPaths(pathsA, pathsB)
+	logResult(r.Context(), "diff", len(data), len(changes), nil)
+	writeJSON(r, http.StatusOK, diffResponse{Changes: changes})
+}
+
+// writeJSON 以指定的状态码输出json响应
+func writeJSON(r *ghttp.Request, status int, resp interface{}) {
+	js, err := json.Marshal(resp)
+	if err != nil {
+		r.Response.WriteStatus(http.StatusInternalServerError, err.Error())
+		return
+	}
+	r.Response.WriteHeader(status)
+	r.Response.Write(js)
+}
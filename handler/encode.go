@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"pb_json/pb"
+
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// maxEncodeBodyBytes /encode请求体的最大字节数，与/decode输出的最大字节数一致
+const maxEncodeBodyBytes = pb.DefaultMaxOutputBytes
+
+var (
+	errBodyTooLarge = errors.New("request body too large")
+)
+
+// Encode 将/decode输出的json数据序列化为PB二进制数据
+// 解析时使用的选择与/decode一样通过opts查询参数或者X-PB-Options头传递，用于确定json中没有记录的类型
+// 失败时与/api_decode一样返回 {"error": "..."}
+func Encode(r *ghttp.Request) {
+	opts, err := requestOptions(r)
+	if err != nil {
+		logResult(r.Context(), "encode", 0, 0, err)
+		writeJSON(r, http.StatusBadRequest, apiErrorResponse{Error: err.Error()})
+		return
+	}
+	// 多读一个字节判断请求体是否超出限制
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxEncodeBodyBytes+1))
+	if err != nil {
+		logResult(r.Context(), "encode", len(data), 0, err)
+		writeJSON(r, http.StatusBadRequest, apiErrorResponse{Error: err.Error()})
+		return
+	}
+	if len(data) > maxEncodeBodyBytes {
+		err = fmt.Errorf("%w: limit %d bytes", errBodyTooLarge, maxEncodeBodyBytes)
+		logResult(r.Context(), "encode", len(data), 0, err)
+		writeJSON(r, http.StatusRequestEntityTooLarge, apiErrorResponse{Error: err.Error()})
+		return
+	}
+	raw, err := pb.EncodeWithOptions(string(data), opts)
+	if err != nil {
+		logResult(r.Context(), "encode", len(data), 0, err)
+		writeJSON(r, http.StatusBadRequest, apiErrorResponse{Error: err.Error()})
+		return
+	}
+	logResult(r.Context(), "encode", len(data), len(raw), nil)
+	r.Response.Header().Set("Content-Type", "application/octet-stream")
+	r.Response.Write(raw)
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// newTestServer 启动绑定了所有接口的测试服务，返回服务地址
+func newTestServer(t *testing.T) string {
+	t.Helper()
+	s := ghttp.GetServer(t.Name())
+	s.SetAddr("127.0.0.1:0")
+	s.SetDumpRouterMap(false)
+	s.SetAccessLogEnabled(false)
+	s.Use(MiddlewareRequestID)
+	s.BindHandler("/decode", Decode)
+	s.BindHandler("/api_decode", ApiDecode)
+	s.BindHandler("/encode", Encode)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Shutdown() })
+	return fmt.Sprintf("http://127.0.0.1:%d", s.GetListenedPort())
+}
+
+// post 发送请求，返回状态码和响应体
+func post(t *testing.T, url string, body string, header http.Header) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+func TestDecodeEmptyBody(t *testing.T) {
+	addr := newTestServer(t)
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"decode", "/decode", ""},
+		{"api_decode", "/api_decode", ""},
+		{"api_decode empty data", "/api_decode", `{"data":""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := post(t, addr+tt.path, tt.body, nil)
+			if status != http.StatusOK || body != emptyResult {
+				t.Errorf("got %d %s, want 200 %s", status, body, emptyResult)
+			}
+		})
+	}
+
+	// 空请求体同样计入/decode的统计
+	before := metrics.snapshot().Actions["decode"].Success
+	post(t, addr+"/decode", "", nil)
+	if got := metrics.snapshot().Actions["decode"].Success; got != before+1 {
+		t.Errorf("decode success got %d, want %d", got, before+1)
+	}
+}
+
+func TestEncodeOptions(t *testing.T) {
+	addr := newTestServer(t)
+	// map的key和value的类型只在选择中记录
+	body := `{"1_map":{"a":1}}`
+	header := http.Header{OptionsHeader: {`{"1":"map","1options":{"1":"string","2":"sint"}}`}}
+	status, got := post(t, addr+"/encode", body, header)
+	if want := "\x0a\x05\x0a\x01a\x10\x02"; status != http.StatusOK || got != want {
+		t.Errorf("got %d %q, want 200 %q", status, got, want)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		header http.Header
+		status int
+	}{
+		{"invalid options", body, http.Header{OptionsHeader: {"{"}}, http.StatusBadRequest},
+		{"invalid key", `{"1_unknown":1}`, nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, got := post(t, addr+"/encode", tt.body, tt.header)
+			var resp apiErrorResponse
+			if err := json.Unmarshal([]byte(got), &resp); err != nil || resp.Error == "" {
+				t.Errorf("got body %q, want json error", got)
+			}
+			if status != tt.status {
+				t.Errorf("got %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	addr := newTestServer(t)
+	tests := []struct {
+		name string
+		id   string
+		keep bool
+	}{
+		{"valid", "req-1.a:b_C", true},
+		{"empty", "", false},
+		{"too long", strings.Repeat("a", maxRequestIDLen+1), false},
+		{"newline", "a\nfake log line", false},
+		{"space", "a b", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, addr+"/decode", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// net/http拒绝发送包含换行的请求头，直接检查过滤函数
+			if strings.ContainsAny(tt.id, "\r\n") {
+				if validRequestID(tt.id) {
+					t.Errorf("validRequestID(%q) got true, want false", tt.id)
+				}
+				return
+			}
+			req.Header.Set(RequestIDHeader, tt.id)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			got := resp.Header.Get(RequestIDHeader)
+			if got == "" || (got == tt.id) != tt.keep {
+				t.Errorf("got request id %q, want kept %v", got, tt.keep)
+			}
+		})
+	}
+}
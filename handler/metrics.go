@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// latencyBucketsMs 解析耗时直方图的上界(毫秒)，最后还有一个不限上界的桶
+var latencyBucketsMs = []int64{1, 5, 10, 50, 100, 500, 1000}
+
+// actionMetrics 一种操作(如decode)的统计
+type actionMetrics struct {
+	// Requests 请求总数
+	Requests int64 `json:"requests"`
+	// Success 成功的请求数
+	Success int64 `json:"success"`
+	// Failure 失败的请求数
+	Failure int64 `json:"failure"`
+	// PayloadBytes 输入数据的总字节数
+	PayloadBytes int64 `json:"payload_bytes"`
+	// AvgPayloadBytes 平均每个请求的输入字节数
+	AvgPayloadBytes float64 `json:"avg_payload_bytes"`
+	// LatencyMs 耗时直方图，key为桶的上界，如 le_5 表示不超过5毫秒，le_inf为所有请求
+	LatencyMs map[string]int64 `json:"latency_ms"`
+	// LatencyMsSum 总耗时(毫秒)
+	LatencyMsSum int64 `json:"latency_ms_sum"`
+}
+
+// metricsRegistry 所有操作的内存统计
+type metricsRegistry struct {
+	mu      sync.Mutex
+	start   time.Time
+	actions map[string]*actionMetrics
+}
+
+// metrics 服务的统计，通过/metrics输出
+var metrics = &metricsRegistry{start: time.Now(), actions: map[string]*actionMetrics{}}
+
+// record 记录一次请求的结果
+// in: 输入数据的字节数
+// latency: 请求的耗时，小于0表示未知，不计入直方图
+func (m *metricsRegistry) record(action string, in int, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.actions[action]
+	if !ok {
+		a = &actionMetrics{LatencyMs: map[string]int64{}}
+		m.actions[action] = a
+	}
+	a.Requests++
+	if err != nil {
+		a.Failure++
+	} else {
+		a.Success++
+	}
+	a.PayloadBytes += int64(in)
+	a.AvgPayloadBytes = float64(a.PayloadBytes) / float64(a.Requests)
+	if latency < 0 {
+		return
+	}
+	ms := latency.Milliseconds()
+	a.LatencyMsSum += ms
+	// 累积直方图，与prometheus的bucket一致
+	for _, le := range latencyBucketsMs {
+		if ms <= le {
+			a.LatencyMs["le_"+strconv.FormatInt(le, 10)]++
+		}
+	}
+	a.LatencyMs["le_inf"]++
+}
+
+// metricsResponse /metrics的响应
+type metricsResponse struct {
+	UptimeSeconds int64                    `json:"uptime_seconds"`
+	Actions       map[string]actionMetrics `json:"actions"`
+}
+
+// snapshot 获取当前统计的副本
+func (m *metricsRegistry) snapshot() metricsResponse {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	resp := metricsResponse{
+		UptimeSeconds: int64(time.Since(m.start).Seconds()),
+		Actions:       make(map[string]actionMetrics, len(m.actions)),
+	}
+	for action, a := range m.actions {
+		c := *a
+		c.LatencyMs = make(map[string]int64, len(a.LatencyMs))
+		for k, v := range a.LatencyMs {
+			c.LatencyMs[k] = v
+		}
+		resp.Actions[action] = c
+	}
+	return resp
+}
+
+// requestLatency 获取请求从进入服务到现在的耗时，ctx中没有请求时返回-1
+func requestLatency(ctx context.Context) time.Duration {
+	r := g.RequestFromCtx(ctx)
+	if r == nil {
+		return -1
+	}
+	return time.Since(time.UnixMilli(r.EnterTime))
+}
+
+// Metrics 以json输出各个操作的请求数、成功失败数、平均输入大小和耗时直方图
+func Metrics(r *ghttp.Request) {
+	r.Response.Header().Set("Content-Type", "application/json")
+	writeJSON(r, http.StatusOK, metrics.snapshot())
+}
+
+// Health 健康检查
+func Health(r *ghttp.Request) {
+	r.Response.Header().Set("Content-Type", "application/json")
+	writeJSON(r, http.StatusOK, map[string]string{"status": "ok"})
+}
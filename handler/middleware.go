@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+	"github.com/gogf/gf/v2/util/guid"
+)
+
+// RequestIDHeader 请求ID的http头
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen 请求头中请求ID的最大长度，超出时重新生成
+const maxRequestIDLen = 64
+
+// ctxKey 请求上下文中变量的key
+type ctxKey string
+
+// RequestIDCtxKey 请求ID在请求上下文中的key，日志通过SetCtxKeys输出
+const RequestIDCtxKey ctxKey = "request_id"
+
+// MiddlewareRequestID 为每个请求分配请求ID，优先使用请求头中的X-Request-ID
+// 请求ID写入请求上下文以便日志输出，并在响应头中返回
+// 请求头中的ID过长或者包含字母、数字和 -_.: 以外的字符时重新生成，避免伪造日志行
+func MiddlewareRequestID(r *ghttp.Request) {
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		id = guid.S()
+	}
+	r.SetCtxVar(RequestIDCtxKey, id)
+	r.Response.Header().Set(RequestIDHeader, id)
+	r.Middleware.Next()
+}
+
+// validRequestID 判断请求头中的请求ID是否可以直接使用
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// logResult 记录一次解析或者序列化的结果，包括输入输出的大小，同时计入/metrics的统计
+func logResult(ctx context.Context, action string, in, out int, err error) {
+	metrics.record(action, in, requestLatency(ctx), err)
+	if err != nil {
+		g.Log().Errorf(ctx, "%s failed: in=%d err=%v", action, in, err)
+		return
+	}
+	g.Log().Infof(ctx, "%s ok: in=%d out=%d", action, in, out)
+}
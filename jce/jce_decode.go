@@ -6,8 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"strconv"
+	"unicode/utf8"
 
 	"pb_json/pb"
+
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 var (
@@ -15,13 +19,52 @@ var (
 	errPBTagTooBig = errors.New("pb's tag too big")
 	// errUnknownType 未知的PB类型
 	errUnknownType = errors.New("unknown type")
+	// errUnsupportedSimpleList simplelist的元素类型不是char
+	errUnsupportedSimpleList = errors.New("unsupported simplelist element type")
 )
 
 type jceImpl struct{}
 
+// Decode 将JCE二进制数据反序列化为json数据
+// raw: 要进行反序列化的JCE数据
+// opts: 用户针对每个字段的干预选择，如字段名称 {"1": "uin", "2options": {"0": "name"}}
+// 配置了名称的字段key为 0001_uin_int64，tag与默认格式一样补零到4位
+func Decode(raw []byte, opts pb.Options) (string, error) {
+	data, err := (&jceImpl{}).Do(raw, opts)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 func (j *jceImpl) Do(raw []byte, opts ...pb.Options) ([]byte, error) {
-	result := pb.JSONResult{}
-	raw, err := jceDecode(raw, result)
+	var opt pb.Options
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	return decodeJSON(newDecodeState(opt), raw, opt)
+}
+
+// DecodeWithNames 将JCE二进制数据反序列化为json数据，key中加上names中的名称，如 0001_userId_int
+// 与在选择中配置字段名称的key格式相同，保留tag以便通过Encode还原
+// 名称对所有层级都生效，包括嵌套的struct以及map和list的元素，names中没有的tag使用默认的格式
+// raw: 要进行反序列化的JCE数据
+// names: tag和字段名称的映射，通常来自Tars/JCE的IDL
+func DecodeWithNames(raw []byte, names map[uint64]string) (string, error) {
+	st := newDecodeState(nil)
+	st.names = names
+	data, err := decodeJSON(st, raw, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// decodeJSON 使用st解析JCE数据并序列化为json
+func decodeJSON(st *decodeState, raw []byte, opt pb.Options) ([]byte, error) {
+	// 按照字段在数据中的顺序输出
+	result := pb.NewOrderedResult()
+	raw, err := jceDecode(st, raw, opt, result)
 	if err != nil {
 		return nil, err
 	}
@@ -77,26 +120,29 @@ const (
 )
 
 var (
-	// jceTypeNamesFormat 类型对应的名称
-	jceTypeNamesFormat = map[pb.Type]string{
-		Zero:            "%04d_zero",
-		Char:            "%04d_char",
-		Short:           "%04d_short",
-		Int:             "%04d_int",
-		Int64:           "%04d_int64",
-		Float:           "%04d_float",
-		Double:          "%04d_double",
-		String1:         "%04d_string",
-		String4:         "%04d_string",
-		Map:             "%04d_map",
-		List:            "%04d_list",
-		SimpleList:      "%04d_simplelist",
-		StructBegin:     "%04d_struct",
-		EmptyMap:        "%04d_emptymap",
-		EmptyList:       "%04d_emptylist",
-		EmptySimpleList: "%04d_emptysimplelist",
+	// jceTypeNames 类型对应的名称
+	jceTypeNames = map[pb.Type]string{
+		Zero:            "zero",
+		Char:            "char",
+		Short:           "short",
+		Int:             "int",
+		Int64:           "int64",
+		Float:           "float",
+		Double:          "double",
+		String1:         "string",
+		String4:         "string",
+		Map:             "map",
+		List:            "list",
+		SimpleList:      "simplelist",
+		StructBegin:     "struct",
+		EmptyMap:        "emptymap",
+		EmptyList:       "emptylist",
+		EmptySimpleList: "emptysimplelist",
 	}
 
+	// jceKeyFormatter jce结果中key的默认格式，tag补零到4位，如 0001_int64
+	jceKeyFormatter = pb.PaddedKeyFormatter(4)
+
 	// errInvalidData 数据为异常的jce数据
 	errInvalidData = func() error { return fmt.Errorf("jce data invalid") }
 )
@@ -107,14 +153,15 @@ type JCEFieldMeta struct {
 	Type pb.Type // 字段的type值
 }
 
-// jceDecode 将JCE二进制数据反序列化为json数据格式的JSONResult
-func jceDecode(raw []byte, result pb.JSONResult) ([]byte, error) {
+// jceDecode 将JCE二进制数据反序列化为json数据格式的结果，字段按照数据中的顺序添加
+// opts: 用户针对每个字段的干预选择，如字段名称
+func jceDecode(st *decodeState, raw []byte, opts pb.Options, result pb.Result) ([]byte, error) {
 	var (
 		err error
 		end bool
 	)
 	for len(raw) > 0 && !end {
-		end, raw, err = readOneValue(raw, result)
+		end, raw, err = readOneValue(st, raw, opts, result)
 		if err != nil {
 			return nil, err
 		}
@@ -143,74 +190,101 @@ func jceReadTagType(raw []byte) (tagType *JCEFieldMeta, rest []byte, err error)
 	return tagType, raw[2:], nil
 }
 
-// readZero 读取zero类型
-func readZero(tag uint64, result pb.JSONResult) {
-	key := fmt.Sprintf(jceTypeNamesFormat[Zero], tag)
+// readZero 读取zero类型，可以通过选择输出为对应的数值类型
+func readZero(st *decodeState, tag uint64, opts pb.Options, result pb.Result) {
+	key := st.formatKey(st.zeroType(opts, tag), tag, opts)
 	result.Append(key, 0)
 }
 
 // readChar 读取char类型
-func readChar(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
+func readChar(st *decodeState, raw []byte, tag uint64, opts pb.Options, result pb.Result) ([]byte, error) {
 	if len(raw) < 1 {
 		return nil, errInvalidData()
 	}
-	key := fmt.Sprintf(jceTypeNamesFormat[Char], tag)
-	result.Append(key, int(raw[0]))
+	key := st.formatKey(Char, tag, opts)
+	if isUnsigned(opts, tag) {
+		result.Append(key, int(raw[0]))
+		return raw[1:], nil
+	}
+	// jce的char为有符号数
+	result.Append(key, int(int8(raw[0])))
 	return raw[1:], nil
 }
 
 // readShort 读取short类型数据
-func readShort(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
+func readShort(st *decodeState, raw []byte, tag uint64, opts pb.Options, result pb.Result) ([]byte, error) {
 	if len(raw) < 2 {
 		return nil, errInvalidData()
 	}
-	key := fmt.Sprintf(jceTypeNamesFormat[Short], tag)
-	result.Append(key, int(binary.BigEndian.Uint16(raw)))
+	key := st.formatKey(Short, tag, opts)
+	if isUnsigned(opts, tag) {
+		result.Append(key, int(binary.BigEndian.Uint16(raw)))
+		return raw[2:], nil
+	}
+	result.Append(key, int(int16(binary.BigEndian.Uint16(raw))))
 	return raw[2:], nil
 }
 
 // readInt 读取int类型数据
-func readInt(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
+func readInt(st *decodeState, raw []byte, tag uint64, opts pb.Options, result pb.Result) ([]byte, error) {
 	if len(raw) < 4 {
 		return nil, errInvalidData()
 	}
-	key := fmt.Sprintf(jceTypeNamesFormat[Int], tag)
-	result.Append(key, int(binary.BigEndian.Uint32(raw)))
+	key := st.formatKey(Int, tag, opts)
+	value := binary.BigEndian.Uint32(raw)
+	if isZigZag(opts, tag) {
+		result.Append(key, int(protowire.DecodeZigZag(uint64(value))))
+		return raw[4:], nil
+	}
+	if isUnsigned(opts, tag) {
+		result.Append(key, value)
+		return raw[4:], nil
+	}
+	result.Append(key, int(int32(value)))
 	return raw[4:], nil
 }
 
 // readInt64 读取int64类型数据
-func readInt64(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
+func readInt64(st *decodeState, raw []byte, tag uint64, opts pb.Options, result pb.Result) ([]byte, error) {
 	if len(raw) < 8 {
 		return nil, errInvalidData()
 	}
-	key := fmt.Sprintf(jceTypeNamesFormat[Int64], tag)
-	result.Append(key, int64(binary.BigEndian.Uint64(raw)))
+	key := st.formatKey(Int64, tag, opts)
+	value := binary.BigEndian.Uint64(raw)
+	if isZigZag(opts, tag) {
+		result.Append(key, st.int64Value(protowire.DecodeZigZag(value)))
+		return raw[8:], nil
+	}
+	if isUnsigned(opts, tag) {
+		result.Append(key, st.uint64Value(value))
+		return raw[8:], nil
+	}
+	result.Append(key, st.int64Value(int64(value)))
 	return raw[8:], nil
 }
 
 // readFloat 读取float类型数据
-func readFloat(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
+func readFloat(st *decodeState, raw []byte, tag uint64, opts pb.Options, result pb.Result) ([]byte, error) {
 	if len(raw) < 4 {
 		return nil, errInvalidData()
 	}
-	key := fmt.Sprintf(jceTypeNamesFormat[Float], tag)
+	key := st.formatKey(Float, tag, opts)
 	result.Append(key, math.Float32frombits(binary.BigEndian.Uint32(raw)))
 	return raw[4:], nil
 }
 
 // readDouble 读取double类型数据
-func readDouble(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
+func readDouble(st *decodeState, raw []byte, tag uint64, opts pb.Options, result pb.Result) ([]byte, error) {
 	if len(raw) < 8 {
 		return nil, errInvalidData()
 	}
-	key := fmt.Sprintf(jceTypeNamesFormat[Double], tag)
+	key := st.formatKey(Double, tag, opts)
 	result.Append(key, math.Float64frombits(binary.BigEndian.Uint64(raw)))
 	return raw[8:], nil
 }
 
 // readString1 读取string1类型数据
-func readString1(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
+func readString1(st *decodeState, raw []byte, tag uint64, opts pb.Options, result pb.Result) ([]byte, error) {
 	if len(raw) < 1 {
 		return nil, errInvalidData()
 	}
@@ -218,13 +292,12 @@ func readString1(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
 	if len(raw) < length+1 {
 		return nil, errInvalidData()
 	}
-	key := fmt.Sprintf(jceTypeNamesFormat[String1], tag)
-	result.Append(key, string(raw[1:length+1]))
+	appendString(st, raw[1:length+1], String1, tag, opts, result)
 	return raw[length+1:], nil
 }
 
 // readString4 读取string4类型数据
-func readString4(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
+func readString4(st *decodeState, raw []byte, tag uint64, opts pb.Options, result pb.Result) ([]byte, error) {
 	if len(raw) < 4 {
 		return nil, errInvalidData()
 	}
@@ -232,19 +305,63 @@ func readString4(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
 	if len(raw) < length+4 {
 		return nil, errInvalidData()
 	}
-	key := fmt.Sprintf(jceTypeNamesFormat[String4], tag)
-	result.Append(key, string(raw[4:length+4]))
+	appendString(st, raw[4:length+4], String4, tag, opts, result)
 	return raw[length+4:], nil
 }
 
+// appendString 添加字符串类型的字段
+// 开启speculate_struct时，不是普通文本并且可以完整解析为结构体的数据作为嵌套的结构体输出
+func appendString(st *decodeState, data []byte, typ pb.Type, tag uint64, opts pb.Options, result pb.Result) {
+	if st.speculateStruct && !isText(data) {
+		if nested, ok := speculateStruct(st, data, opts.GetOptionsByTag(strconv.FormatUint(tag, 10))); ok {
+			result.Append(st.formatKey(StructBegin, tag, opts), nested)
+			return
+		}
+	}
+	result.Append(st.formatKey(typ, tag, opts), pb.TruncateString(data, st.maxStringLen))
+}
+
+// speculateStruct 尝试将数据解析为结构体，数据需要被完整解析并且至少包含一个字段
+func speculateStruct(st *decodeState, data []byte, opts pb.Options) (*pb.OrderedResult, bool) {
+	if err := st.enter(); err != nil {
+		return nil, false
+	}
+	defer st.leave()
+	nested := pb.NewOrderedResult()
+	rest, err := jceDecode(st, data, opts, nested)
+	if err != nil || len(rest) != 0 || nested.Len() == 0 {
+		return nil, false
+	}
+	return nested, true
+}
+
+// isText 判断数据是否是普通文本，即合法的UTF-8并且除了制表符、换行符和回车符之外没有控制字符
+// 结构体的数据中总是包含tag为0到1的头部，这些字节都是控制字符
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, c := range data {
+		if (c < ' ' && c != '\t' && c != '\n' && c != '\r') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
 // readStruct 读取结构体数据
-func readStruct(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
-	newResult := pb.JSONResult{}
-	raw, err := jceDecode(raw, newResult)
+func readStruct(st *decodeState, raw []byte, tag uint64, opts pb.Options, result pb.Result) ([]byte, error) {
+	if err := st.enter(); err != nil {
+		return nil, err
+	}
+	defer st.leave()
+	newResult := pb.NewOrderedResult()
+	// 嵌套结构体使用自己的选择
+	raw, err := jceDecode(st, raw, opts.GetOptionsByTag(strconv.FormatUint(tag, 10)), newResult)
 	if err != nil {
 		return nil, err
 	}
-	key := fmt.Sprintf(jceTypeNamesFormat[StructBegin], tag)
+	key := st.formatKey(StructBegin, tag, opts)
 	result.Append(key, newResult)
 	return raw, nil
 }
@@ -290,7 +407,11 @@ func readLength(raw []byte) (length int, rest []byte, err error) {
 }
 
 // readMap 读取map类型数据
-func readMap(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
+func readMap(st *decodeState, raw []byte, tag uint64, opts pb.Options, result pb.Result) ([]byte, error) {
+	if err := st.enter(); err != nil {
+		return nil, err
+	}
+	defer st.leave()
 	var length int
 	var err error
 	length, raw, err = readLength(raw)
@@ -298,20 +419,22 @@ func readMap(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
 		return nil, err
 	}
 	if length == 0 {
-		key := fmt.Sprintf(jceTypeNamesFormat[EmptyMap], tag)
+		key := st.formatKey(EmptyMap, tag, opts)
 		result.Append(key, nil)
 		return raw, nil
 	}
-	key := fmt.Sprintf(jceTypeNamesFormat[Map], tag)
+	key := st.formatKey(Map, tag, opts)
+	// map的key的tag为0，value的tag为1
+	itemOpts := opts.GetOptionsByTag(strconv.FormatUint(tag, 10))
 	for i := 0; i < length; i++ {
-		mapItem := pb.JSONResult{}
+		mapItem := pb.NewOrderedResult()
 		// 读取map key
-		raw, err = readMapKey(raw, mapItem)
+		raw, err = readMapKey(st, raw, itemOpts, mapItem)
 		if err != nil {
 			return nil, err
 		}
 		// 读取map value
-		_, raw, err = readOneValue(raw, mapItem)
+		_, raw, err = readOneValue(st, raw, itemOpts, mapItem)
 		if err != nil {
 			return nil, err
 		}
@@ -321,30 +444,30 @@ func readMap(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
 }
 
 // readMapKey 读取map的key值
-func readMapKey(raw []byte, result pb.JSONResult) ([]byte, error) {
+func readMapKey(st *decodeState, raw []byte, opts pb.Options, result pb.Result) ([]byte, error) {
 	tagType, raw, err := jceReadTagType(raw)
 	if err != nil {
 		return nil, err
 	}
 	switch tagType.Type {
 	case Char:
-		raw, err = readChar(raw, tagType.Tag, result)
+		raw, err = readChar(st, raw, tagType.Tag, opts, result)
 	case Short:
-		raw, err = readShort(raw, tagType.Tag, result)
+		raw, err = readShort(st, raw, tagType.Tag, opts, result)
 	case Int:
-		raw, err = readInt(raw, tagType.Tag, result)
+		raw, err = readInt(st, raw, tagType.Tag, opts, result)
 	case Int64:
-		raw, err = readInt64(raw, tagType.Tag, result)
+		raw, err = readInt64(st, raw, tagType.Tag, opts, result)
 	case Float:
-		raw, err = readFloat(raw, tagType.Tag, result)
+		raw, err = readFloat(st, raw, tagType.Tag, opts, result)
 	case Double:
-		raw, err = readDouble(raw, tagType.Tag, result)
+		raw, err = readDouble(st, raw, tagType.Tag, opts, result)
 	case String1:
-		raw, err = readString1(raw, tagType.Tag, result)
+		raw, err = readString1(st, raw, tagType.Tag, opts, result)
 	case String4:
-		raw, err = readString4(raw, tagType.Tag, result)
+		raw, err = readString4(st, raw, tagType.Tag, opts, result)
 	case StructBegin:
-		raw, err = readStruct(raw, tagType.Tag, result)
+		raw, err = readStruct(st, raw, tagType.Tag, opts, result)
 	case StructEnd:
 		return raw, nil
 	default:
@@ -363,7 +486,7 @@ func readMapKey(raw []byte, result pb.JSONResult) ([]byte, error) {
 // end: 当前struct是否已经结束
 // rest: 剩余为处理的数据
 // err: 出错信息
-func readOneValue(raw []byte, result pb.JSONResult) (end bool, rest []byte, err error) {
+func readOneValue(st *decodeState, raw []byte, opts pb.Options, result pb.Result) (end bool, rest []byte, err error) {
 	// 读取tag和type
 	tagType, raw, err := jceReadTagType(raw)
 	if err != nil {
@@ -371,33 +494,33 @@ func readOneValue(raw []byte, result pb.JSONResult) (end bool, rest []byte, err
 	}
 	switch tagType.Type {
 	case Char:
-		raw, err = readChar(raw, tagType.Tag, result)
+		raw, err = readChar(st, raw, tagType.Tag, opts, result)
 	case Short:
-		raw, err = readShort(raw, tagType.Tag, result)
+		raw, err = readShort(st, raw, tagType.Tag, opts, result)
 	case Int:
-		raw, err = readInt(raw, tagType.Tag, result)
+		raw, err = readInt(st, raw, tagType.Tag, opts, result)
 	case Int64:
-		raw, err = readInt64(raw, tagType.Tag, result)
+		raw, err = readInt64(st, raw, tagType.Tag, opts, result)
 	case Float:
-		raw, err = readFloat(raw, tagType.Tag, result)
+		raw, err = readFloat(st, raw, tagType.Tag, opts, result)
 	case Double:
-		raw, err = readDouble(raw, tagType.Tag, result)
+		raw, err = readDouble(st, raw, tagType.Tag, opts, result)
 	case String1:
-		raw, err = readString1(raw, tagType.Tag, result)
+		raw, err = readString1(st, raw, tagType.Tag, opts, result)
 	case String4:
-		raw, err = readString4(raw, tagType.Tag, result)
+		raw, err = readString4(st, raw, tagType.Tag, opts, result)
 	case Map:
-		raw, err = readMap(raw, tagType.Tag, result)
+		raw, err = readMap(st, raw, tagType.Tag, opts, result)
 	case List:
-		raw, err = readList(raw, tagType.Tag, result)
+		raw, err = readList(st, raw, tagType.Tag, opts, result)
 	case StructBegin:
-		raw, err = readStruct(raw, tagType.Tag, result)
+		raw, err = readStruct(st, raw, tagType.Tag, opts, result)
 	case StructEnd:
 		return true, raw, nil
 	case Zero:
-		readZero(tagType.Tag, result)
+		readZero(st, tagType.Tag, opts, result)
 	case SimpleList:
-		raw, err = readSimpleList(raw, tagType.Tag, result)
+		raw, err = readSimpleList(st, raw, tagType.Tag, opts, result)
 	default:
 		return false, nil, errUnknownType
 	}
@@ -408,20 +531,25 @@ func readOneValue(raw []byte, result pb.JSONResult) (end bool, rest []byte, err
 }
 
 // readSimpleList 读取simplelist类型数据([]byte类型)
-func readSimpleList(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
-	var err error
-	// jce的simplelist当前仅支持[]byte类型
-	_, raw, err = jceReadTagType(raw)
+func readSimpleList(st *decodeState, raw []byte, tag uint64, opts pb.Options, result pb.Result) ([]byte, error) {
+	// jce的simplelist只有[]byte类型，元素类型为char，其它元素类型无法确定长度的含义
+	elemType, raw, err := jceReadTagType(raw)
 	if err != nil {
 		return nil, err
 	}
+	if elemType.Type != Char {
+		return nil, fmt.Errorf("%w: tag %d, element type %d", errUnsupportedSimpleList, tag, elemType.Type)
+	}
 	var length int
 	length, raw, err = readLength(raw)
 	if err != nil {
 		return nil, err
 	}
+	if length < 0 || len(raw) < length {
+		return nil, errInvalidData()
+	}
 	if length == 0 {
-		key := fmt.Sprintf(jceTypeNamesFormat[EmptySimpleList], tag)
+		key := st.formatKey(EmptySimpleList, tag, opts)
 		result.Append(key, nil)
 		return raw, nil
 	}
@@ -429,29 +557,49 @@ func readSimpleList(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error
 	for _, b := range raw[:length] {
 		simpleList = append(simpleList, int(b))
 	}
-	key := fmt.Sprintf(jceTypeNamesFormat[SimpleList], tag)
+	key := st.formatKey(SimpleList, tag, opts)
 	result.Append(key, simpleList)
 	return raw[length:], nil
 }
 
+// listItemValue 获取list元素的值，元素只有一个tag为0的值，结构体结束等没有值时为nil
+func listItemValue(item *pb.OrderedResult) interface{} {
+	keys := item.Keys()
+	if len(keys) != 1 {
+		return nil
+	}
+	value, _ := item.Get(keys[0])
+	return value
+}
+
 // readList 读取lsit类型数据
-func readList(raw []byte, tag uint64, result pb.JSONResult) ([]byte, error) {
+func readList(st *decodeState, raw []byte, tag uint64, opts pb.Options, result pb.Result) ([]byte, error) {
+	if err := st.enter(); err != nil {
+		return nil, err
+	}
+	defer st.leave()
 	length, raw, err := readLength(raw)
 	if err != nil {
 		return nil, err
 	}
 	if length == 0 {
-		key := fmt.Sprintf(jceTypeNamesFormat[EmptyList], tag)
+		key := st.formatKey(EmptyList, tag, opts)
 		result.Append(key, nil)
 		return raw, nil
 	}
-	key := fmt.Sprintf(jceTypeNamesFormat[List], tag)
+	key := st.formatKey(List, tag, opts)
+	// list元素的tag为0
+	itemOpts := opts.GetOptionsByTag(strconv.FormatUint(tag, 10))
 	for i := 0; i < length; i++ {
-		listItem := pb.JSONResult{}
-		_, raw, err = readOneValue(raw, listItem)
+		listItem := pb.NewOrderedResult()
+		_, raw, err = readOneValue(st, raw, itemOpts, listItem)
 		if err != nil {
 			return nil, err
 		}
+		if st.flatList {
+			result.AppendArrayItem(key, listItemValue(listItem))
+			continue
+		}
 		result.AppendArrayItem(key, listItem)
 	}
 	return raw, nil
@@ -0,0 +1,214 @@
+package jce
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"pb_json/pb"
+)
+
+// appendCharList 构造元素为char的list，tag为0时作为list的元素
+func appendCharList(buf []byte, tag uint64, values ...byte) []byte {
+	buf = appendLength(appendHead(buf, List, tag), len(values))
+	for _, v := range values {
+		buf = append(appendHead(buf, Char, 0), v)
+	}
+	return buf
+}
+
+func TestDecodeNestedList(t *testing.T) {
+	// list<list<char>>: [[1, 2], [3]]
+	raw := appendLength(appendHead(nil, List, 1), 2)
+	raw = appendCharList(raw, 0, 1, 2)
+	raw = appendCharList(raw, 0, 3)
+
+	got, err := Decode(raw, pb.Options{OptionFlatList: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"0001_list":[[1,2],[3]]}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// 默认选择下元素保留类型，可以还原为原始数据
+	wrapped, err := Decode(raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"0001_list":[{"0000_list":[{"0000_char":1},{"0000_char":2}]},{"0000_list":[{"0000_char":3}]}]}`; wrapped != want {
+		t.Errorf("got %s, want %s", wrapped, want)
+	}
+	var result pb.JSONResult
+	if err := json.Unmarshal([]byte(wrapped), &result); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := Encode(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, raw) {
+		t.Errorf("encode got %x, want %x", encoded, raw)
+	}
+}
+
+func TestDecodeSimpleListElementType(t *testing.T) {
+	// simplelist的元素类型为int
+	raw := appendLength(appendHead(appendHead(nil, SimpleList, 1), Int, 0), 1)
+	raw = append(raw, 1)
+	if _, err := Decode(raw, nil); !errors.Is(err, errUnsupportedSimpleList) {
+		t.Fatalf("got %v, want %v", err, errUnsupportedSimpleList)
+	}
+}
+
+func TestDecodeTooDeep(t *testing.T) {
+	var structs, lists []byte
+	for i := 0; i < 200; i++ {
+		structs = appendHead(structs, StructBegin, 0)
+		lists = appendLength(appendHead(lists, List, 0), 1)
+	}
+	for i := 0; i < 200; i++ {
+		structs = appendHead(structs, StructEnd, 0)
+	}
+	lists = appendLength(appendHead(lists, List, 0), 0)
+	for _, raw := range [][]byte{structs, lists} {
+		if _, err := Decode(raw, nil); !errors.Is(err, pb.ErrTooDeep) {
+			t.Errorf("got %v, want %v", err, pb.ErrTooDeep)
+		}
+	}
+	// max_depth可以是json解析得到的float64，也可以是代码中设置的int
+	shallow := appendHead(appendHead(appendHead(appendHead(nil, StructBegin, 0), StructBegin, 0), StructEnd, 0), StructEnd, 0)
+	for _, max := range []interface{}{1, float64(1)} {
+		if _, err := Decode(shallow, pb.Options{pb.OptionMaxDepth: max}); !errors.Is(err, pb.ErrTooDeep) {
+			t.Errorf("max_depth %T: got %v, want %v", max, err, pb.ErrTooDeep)
+		}
+	}
+	if _, err := Decode(shallow, pb.Options{pb.OptionMaxDepth: 2}); err != nil {
+		t.Errorf("max_depth 2: %v", err)
+	}
+}
+
+func TestDecodeKeyFormat(t *testing.T) {
+	raw := append(appendHead(nil, Char, 1), 7)
+	raw = append(append(appendHead(raw, String1, 2), 2), "hi"...)
+	tests := []struct {
+		name string
+		opts pb.Options
+		want string
+	}{
+		{"default", nil, `{"0001_char":7,"0002_string":"hi"}`},
+		{"plain", pb.Options{OptionKeyFormat: KeyFormatPlain}, `{"1":7,"2":"hi"}`},
+		{"template", pb.Options{OptionKeyFormat: "{type}_{tag}"}, `{"char_1":7,"string_2":"hi"}`},
+		{"template with name", pb.Options{OptionKeyFormat: "{name}#{tag}", "1": "uin"}, `{"uin#1":7,"#2":"hi"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(raw, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeZigZag(t *testing.T) {
+	// 同样的数据按照普通的有符号数和zigzag编码解析，0xffffffff为-1，zigzag为-2147483648
+	raw := binary.BigEndian.AppendUint32(appendHead(nil, Int, 1), 0xffffffff)
+	raw = binary.BigEndian.AppendUint64(appendHead(raw, Int64, 2), 3)
+	zigzag := map[string]interface{}{"zigzag": true}
+	tests := []struct {
+		name string
+		opts pb.Options
+		want string
+	}{
+		{"plain", nil, `{"0001_int":-1,"0002_int64":3}`},
+		{"zigzag", pb.Options{"1": zigzag, "2": zigzag}, `{"0001_int":-2147483648,"0002_int64":-2}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(raw, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeWireOrder(t *testing.T) {
+	// 字段不按tag顺序出现，输出保持原始顺序
+	var inner []byte
+	inner = append(appendHead(inner, Char, 2), 2)
+	inner = append(appendHead(inner, Char, 0), 0)
+	raw := append(appendHead(nil, Char, 3), 3)
+	raw = append(appendHead(raw, StructBegin, 1), inner...)
+	raw = appendHead(raw, StructEnd, 0)
+	raw = append(appendHead(raw, Char, 0), 0)
+	got, err := Decode(raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"0003_char":3,"0001_struct":{"0002_char":2,"0000_char":0},"0000_char":0}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestDecodeFieldNames(t *testing.T) {
+	var inner []byte
+	inner = append(appendHead(inner, Char, 0), 1)
+	inner = append(appendHead(inner, Char, 1), 2)
+	raw := binary.BigEndian.AppendUint64(appendHead(nil, Int64, 1), 10000)
+	raw = append(appendHead(raw, StructBegin, 2), inner...)
+	raw = appendHead(raw, StructEnd, 0)
+
+	got, err := Decode(raw, pb.Options{"1": "uin", "2": "info", "2options": map[string]interface{}{"0": "age"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"0001_uin_int64":10000,"0002_info_struct":{"0000_age_char":1,"0001_char":2}}`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// names对所有层级生效，与选择中的名称使用相同的key格式
+	got, err = DecodeWithNames(raw, map[uint64]string{0: "age", 2: "info"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{"0001_int64":10000,"0002_info_struct":{"0000_age_char":1,"0001_char":2}}`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	var result pb.JSONResult
+	if err := json.Unmarshal([]byte(got), &result); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := Encode(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, raw) {
+		t.Errorf("encode got %x, want %x", encoded, raw)
+	}
+}
+
+func TestDecodeMaxStringLen(t *testing.T) {
+	raw := append(append(appendHead(nil, String1, 1), 5), "hello"...)
+	// max_string_len可以是json解析得到的float64，也可以是代码中设置的int
+	for _, max := range []interface{}{2, float64(2)} {
+		got, err := Decode(raw, pb.Options{pb.OptionMaxStringLen: max})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"0001_string":"he…(+3 bytes)"}`; got != want {
+			t.Errorf("max_string_len %T: got %s, want %s", max, got, want)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package jce
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pb_json/pb"
+)
+
+var (
+	// errInvalidKey 字段的key不是 tag_type 或者 tag_name_type 格式
+	errInvalidKey = errors.New("invalid field key")
+	// errInvalidValue 字段的值与类型不匹配
+	errInvalidValue = errors.New("invalid field value")
+)
+
+// jceNamesToType 名称和对应类型的映射，string根据长度选择String1或者String4
+var jceNamesToType = map[string]pb.Type{
+	"zero":            Zero,
+	"char":            Char,
+	"short":           Short,
+	"int":             Int,
+	"int64":           Int64,
+	"float":           Float,
+	"double":          Double,
+	"string":          String1,
+	"map":             Map,
+	"list":            List,
+	"simplelist":      SimpleList,
+	"struct":          StructBegin,
+	"emptymap":        EmptyMap,
+	"emptylist":       EmptyList,
+	"emptysimplelist": EmptySimpleList,
+}
+
+// encodedField 待序列化的字段
+type encodedField struct {
+	key   string
+	tag   uint64
+	typ   pb.Type
+	value interface{}
+}
+
+// Encode 将Decode输出的结果序列化为JCE二进制数据，字段按照tag排序
+// key为默认的 %04d_type 格式或者配置了字段名称的 %04d_name_type 格式，其它key_format的结果无法还原
+// 标准编码器输出的数据使用默认选择解析后再序列化与原始数据一致，flat_list的结果无法还原
+func Encode(result pb.JSONResult) ([]byte, error) {
+	return encodeStruct(nil, map[string]interface{}(result))
+}
+
+// encodeStruct 序列化结构体的字段，不包括StructBegin和StructEnd
+// value: map[string]interface{}、pb.JSONResult或者*pb.OrderedResult
+func encodeStruct(buf []byte, value interface{}) ([]byte, error) {
+	fields, err := structFields(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		// 重复的tag解析为数组，list、map和simplelist本身就是数组
+		items, ok := f.value.([]interface{})
+		if !ok || f.typ == List || f.typ == Map || f.typ == SimpleList {
+			items = []interface{}{f.value}
+		}
+		for _, item := range items {
+			if buf, err = encodeValue(buf, f.tag, f.typ, item); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.key, err)
+			}
+		}
+	}
+	return buf, nil
+}
+
+// structFields 获取结构体的字段，按照tag排序
+func structFields(value interface{}) ([]encodedField, error) {
+	var values map[string]interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		values = v
+	case pb.JSONResult:
+		values = v
+	case *pb.OrderedResult:
+		values = make(map[string]interface{}, v.Len())
+		for _, k := range v.Keys() {
+			values[k], _ = v.Get(k)
+		}
+	default:
+		return nil, errInvalidValue
+	}
+	fields := make([]encodedField, 0, len(values))
+	for k, v := range values {
+		tag, typ, err := parseFieldKey(k)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, encodedField{key: k, tag: tag, typ: typ, value: v})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].tag != fields[j].tag {
+			return fields[i].tag < fields[j].tag
+		}
+		return fields[i].key < fields[j].key
+	})
+	return fields, nil
+}
+
+// parseFieldKey 从key中解析tag和类型，类型为最后一个下划线之后的部分
+func parseFieldKey(key string) (uint64, pb.Type, error) {
+	idx := strings.IndexByte(key, '_')
+	if idx <= 0 {
+		return 0, 0, fmt.Errorf("%w: %s", errInvalidKey, key)
+	}
+	tag, err := strconv.ParseUint(key[:idx], 10, 8)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %s", errInvalidKey, key)
+	}
+	typ, ok := jceNamesToType[key[strings.LastIndexByte(key, '_')+1:]]
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %s", errInvalidKey, key)
+	}
+	return tag, typ, nil
+}
+
+// appendHead 写入tag和type，tag大于等于15时使用两个字节
+func appendHead(buf []byte, typ pb.Type, tag uint64) []byte {
+	if tag < 15 {
+		return append(buf, byte(tag<<4)|byte(typ))
+	}
+	return append(buf, 0xF0|byte(typ), byte(tag))
+}
+
+// appendLength 写入map、list和simplelist的长度，与标准编码器一致使用tag为0的最短整数类型
+func appendLength(buf []byte, length int) []byte {
+	switch {
+	case length == 0:
+		return appendHead(buf, Zero, 0)
+	case length <= math.MaxInt8:
+		return append(appendHead(buf, Char, 0), byte(length))
+	case length <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(appendHead(buf, Short, 0), uint16(length))
+	}
+	return binary.BigEndian.AppendUint32(appendHead(buf, Int, 0), uint32(length))
+}
+
+// encodeValue 序列化一个字段
+func encodeValue(buf []byte, tag uint64, typ pb.Type, value interface{}) ([]byte, error) {
+	switch typ {
+	case Zero:
+		return appendHead(buf, Zero, tag), nil
+	case Char, Short, Int, Int64:
+		v, err := toInt64(value)
+		if err != nil {
+			return nil, err
+		}
+		buf = appendHead(buf, typ, tag)
+		switch typ {
+		case Char:
+			return append(buf, byte(v)), nil
+		case Short:
+			return binary.BigEndian.AppendUint16(buf, uint16(v)), nil
+		case Int:
+			return binary.BigEndian.AppendUint32(buf, uint32(v)), nil
+		}
+		return binary.BigEndian.AppendUint64(buf, uint64(v)), nil
+	case Float:
+		v, err := toFloat64(value)
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint32(appendHead(buf, Float, tag), math.Float32bits(float32(v))), nil
+	case Double:
+		v, err := toFloat64(value)
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint64(appendHead(buf, Double, tag), math.Float64bits(v)), nil
+	case String1:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errInvalidValue
+		}
+		if len(s) <= math.MaxUint8 {
+			buf = append(appendHead(buf, String1, tag), byte(len(s)))
+			return append(buf, s...), nil
+		}
+		buf = binary.BigEndian.AppendUint32(appendHead(buf, String4, tag), uint32(len(s)))
+		return append(buf, s...), nil
+	case StructBegin:
+		buf, err := encodeStruct(appendHead(buf, StructBegin, tag), value)
+		if err != nil {
+			return nil, err
+		}
+		return appendHead(buf, StructEnd, 0), nil
+	case Map, List:
+		// map的元素为key(tag 0)和value(tag 1)，list的元素为tag 0的值
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, errInvalidValue
+		}
+		buf = appendLength(appendHead(buf, typ, tag), len(items))
+		var err error
+		for _, item := range items {
+			if buf, err = encodeStruct(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case SimpleList:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, errInvalidValue
+		}
+		buf = appendLength(appendHead(appendHead(buf, SimpleList, tag), Char, 0), len(items))
+		for _, item := range items {
+			v, err := toInt64(item)
+			if err != nil {
+				return nil, err
+			}
+			buf = append(buf, byte(v))
+		}
+		return buf, nil
+	case EmptyMap:
+		return appendLength(appendHead(buf, Map, tag), 0), nil
+	case EmptyList:
+		return appendLength(appendHead(buf, List, tag), 0), nil
+	case EmptySimpleList:
+		return appendLength(appendHead(appendHead(buf, SimpleList, tag), Char, 0), 0), nil
+	}
+	return nil, fmt.Errorf("%w: unsupported type %d", errInvalidValue, typ)
+}
+
+// toInt64 将解析结果中的整数转换为int64，兼容json解析得到的float64和json.Number
+func toInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, errInvalidValue
+		}
+		return int64(v), nil
+	case json.Number:
+		n, err := strconv.ParseInt(v.String(), 10, 64)
+		if err != nil {
+			// unsigned解析出的int64可能超出有符号数的范围
+			u, uerr := strconv.ParseUint(v.String(), 10, 64)
+			if uerr != nil {
+				return 0, fmt.Errorf("%w: %v", errInvalidValue, err)
+			}
+			return int64(u), nil
+		}
+		return n, nil
+	}
+	return 0, errInvalidValue
+}
+
+// toFloat64 将解析结果中的浮点数转换为float64
+func toFloat64(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", errInvalidValue, err)
+		}
+		return f, nil
+	}
+	return 0, errInvalidValue
+}
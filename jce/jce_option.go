@@ -0,0 +1,223 @@
+package jce
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"pb_json/pb"
+)
+
+// 全局选择的key，与tag的key不会冲突
+const (
+	// OptionKeyFormat 结果中key的格式，为空时使用默认的 %04d_type 格式
+	// plain表示只输出tag，其它值作为模板，支持{tag}、{type}、{name}占位符
+	OptionKeyFormat = "key_format"
+	// OptionZeroAs zero类型输出为该数值类型的key，如 int 时输出为 0001_int: 0，为空时保持 0001_zero: 0
+	OptionZeroAs = "zero_as"
+
+	// OptionSpeculateStruct 为true时尝试将不是普通文本的字符串解析为嵌套的结构体，可以完整解析时输出为struct
+	OptionSpeculateStruct = "speculate_struct"
+	// OptionFlatList 为true时list的元素直接输出为值，不再包装为 {"0000_type": value}
+	// 嵌套的list输出为嵌套的数组，如 [[1, 2], [3]]，元素的类型丢失，结果无法通过Encode还原
+	OptionFlatList = "flat_list"
+
+	// KeyFormatPlain 只输出tag的key格式
+	KeyFormatPlain = "plain"
+)
+
+// 字段选择中使用的key
+const (
+	// nameKey 字段选择中字段名称的key
+	nameKey = "name"
+	// zigzagKey 字段选择中int和int64是否使用zigzag编码的key，用于自定义的jce方言
+	zigzagKey = "zigzag"
+	// unsignedKey 字段选择中整数是否按无符号数解析的key，如 {"1": {"unsigned": true}}
+	// 对char、short、int和int64生效，同时配置zigzag时zigzag优先
+	unsignedKey = "unsigned"
+	// zeroTypeKey 字段选择中zero类型输出的数值类型，优先于全局的zero_as，如 {"1": {"zero_type": "int64"}}
+	zeroTypeKey = "zero_type"
+)
+
+// zeroTypes zero类型可以输出为的数值类型
+var zeroTypes = map[string]pb.Type{
+	"char":   Char,
+	"short":  Short,
+	"int":    Int,
+	"int64":  Int64,
+	"float":  Float,
+	"double": Double,
+}
+
+// decodeState 一次JCE解析过程中共享的状态，嵌套解析时一并传递
+type decodeState struct {
+	// keyFormat 结果中key的格式
+	keyFormat string
+	// keyFormatter 默认格式下生成key的函数，与pb.OptionKeyFormatter一致
+	keyFormatter pb.KeyFormatter
+	// depth 当前的嵌套深度
+	depth int
+	// maxDepth 允许的最大嵌套深度，与pb.OptionMaxDepth一致
+	maxDepth int
+	// zeroAs zero类型输出的数值类型，为空时输出为zero
+	zeroAs string
+	// maxStringLen 字符串输出的最大长度，0表示不限制，与pb.OptionMaxStringLen一致
+	maxStringLen int
+	// speculateStruct 尝试将字符串解析为嵌套的结构体
+	speculateStruct bool
+	// int64AsNumber int64只在安全范围内输出为数值，超出范围输出为字符串，与pb.OptionInt64AsNumber一致
+	int64AsNumber bool
+	// flatList list的元素直接输出为值
+	flatList bool
+	// names 所有层级共用的tag和字段名称的映射，优先级低于选择中配置的字段名称
+	names map[uint64]string
+}
+
+// newDecodeState 根据顶层的用户选择创建解析状态
+func newDecodeState(opts pb.Options) *decodeState {
+	st := &decodeState{keyFormatter: jceKeyFormatter}
+	if f := opts.KeyFormatter(); f != nil {
+		st.keyFormatter = f
+	}
+	st.keyFormat, _ = opts[OptionKeyFormat].(string)
+	st.zeroAs, _ = opts[OptionZeroAs].(string)
+	st.speculateStruct, _ = opts[OptionSpeculateStruct].(bool)
+	st.int64AsNumber, _ = opts[pb.OptionInt64AsNumber].(bool)
+	st.flatList, _ = opts[OptionFlatList].(bool)
+	st.maxDepth = getInt(opts, pb.OptionMaxDepth, pb.DefaultMaxDepth)
+	st.maxStringLen = getInt(opts, pb.OptionMaxStringLen, 0)
+	return st
+}
+
+// getInt 获取整数选择，兼容json解析得到的float64和代码中直接设置的int，没有配置时返回def
+func getInt(opts pb.Options, key string, def int) int {
+	switch value := opts[key].(type) {
+	case float64:
+		return int(value)
+	case int:
+		return value
+	}
+	return def
+}
+
+// enter 进入一层嵌套(struct、map、list)，超出最大深度时返回pb.ErrTooDeep，返回nil时需要调用leave
+func (s *decodeState) enter() error {
+	if s.depth >= s.maxDepth {
+		return fmt.Errorf("%w %d", pb.ErrTooDeep, s.maxDepth)
+	}
+	s.depth++
+	return nil
+}
+
+// leave 离开一层嵌套
+func (s *decodeState) leave() {
+	s.depth--
+}
+
+// getFieldName 获取tag对应的字段名称，没有配置则返回空字符串
+// 支持两种写法: {"1": "uin"} 和 {"1": {"name": "uin"}}
+// 嵌套结构体的名称通过 {"1options": {...}} 配置，与pb.Options的约定一致
+func getFieldName(opts pb.Options, tag uint64) string {
+	if opts == nil {
+		return ""
+	}
+	switch v := opts[strconv.FormatUint(tag, 10)].(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if name, ok := v[nameKey].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// getFieldBool 获取字段选择对象中bool类型的值，如 {"1": {"zigzag": true}}
+func getFieldBool(opts pb.Options, tag uint64, key string) bool {
+	if opts == nil {
+		return false
+	}
+	opt, ok := opts[strconv.FormatUint(tag, 10)].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	value, _ := opt[key].(bool)
+	return value
+}
+
+// getFieldString 获取字段选择对象中字符串类型的值
+func getFieldString(opts pb.Options, tag uint64, key string) string {
+	if opts == nil {
+		return ""
+	}
+	opt, ok := opts[strconv.FormatUint(tag, 10)].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	value, _ := opt[key].(string)
+	return value
+}
+
+// zeroType 获取zero类型的字段输出的类型，没有配置或者配置的不是数值类型时为Zero
+func (s *decodeState) zeroType(opts pb.Options, tag uint64) pb.Type {
+	name := getFieldString(opts, tag, zeroTypeKey)
+	if name == "" {
+		name = s.zeroAs
+	}
+	if typ, ok := zeroTypes[name]; ok {
+		return typ
+	}
+	return Zero
+}
+
+// isZigZag 判断tag对应的整数是否使用zigzag编码
+func isZigZag(opts pb.Options, tag uint64) bool {
+	return getFieldBool(opts, tag, zigzagKey)
+}
+
+// int64Value 输出int64，选择了int64_as_number时超出安全范围的值输出为字符串
+func (s *decodeState) int64Value(v int64) interface{} {
+	if s.int64AsNumber && (v > pb.MaxSafeInteger || v < -pb.MaxSafeInteger) {
+		return strconv.FormatInt(v, 10)
+	}
+	return v
+}
+
+// uint64Value 输出无符号的int64，规则与int64Value相同
+func (s *decodeState) uint64Value(v uint64) interface{} {
+	if s.int64AsNumber && v > pb.MaxSafeInteger {
+		return strconv.FormatUint(v, 10)
+	}
+	return v
+}
+
+// isUnsigned 判断tag对应的整数是否按无符号数解析
+func isUnsigned(opts pb.Options, tag uint64) bool {
+	return getFieldBool(opts, tag, unsignedKey)
+}
+
+// formatKey 生成字段在结果中的key，默认格式下配置了字段名称时key为 tag_name_type
+// tag与没有名称的key一样补零到4位，如 0001_uin_int64，保证同一层级的key按tag对齐，且可以通过Encode还原
+// 当前层级的选择中没有名称时使用names中的名称
+func (s *decodeState) formatKey(typ pb.Type, tag uint64, opts pb.Options) string {
+	name := getFieldName(opts, tag)
+	if name == "" {
+		name = s.names[tag]
+	}
+	switch s.keyFormat {
+	case "":
+	case KeyFormatPlain:
+		return strconv.FormatUint(tag, 10)
+	default:
+		return strings.NewReplacer(
+			"{tag}", strconv.FormatUint(tag, 10),
+			"{type}", jceTypeNames[typ],
+			"{name}", name,
+		).Replace(s.keyFormat)
+	}
+
+	if name == "" {
+		return s.keyFormatter(tag, jceTypeNames[typ])
+	}
+	return s.keyFormatter(tag, name+"_"+jceTypeNames[typ])
+}
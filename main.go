@@ -11,9 +11,16 @@ import (
 
 func main() {
 	s := g.Server()
+	// 日志中输出请求ID
+	g.Log().SetCtxKeys(handler.RequestIDCtxKey)
+	s.Use(handler.MiddlewareRequestID)
 
 	s.BindHandler("/decode", handler.Decode)
 	s.BindHandler("/api_decode", handler.ApiDecode)
+	s.BindHandler("/encode", handler.Encode)
+	s.BindHandler("/diff", handler.Diff)
+	s.BindHandler("/metrics", handler.Metrics)
+	s.BindHandler("/health", handler.Health)
 
 	port := g.Cfg().MustGet(context.Background(), "port")
 	s.SetPort(port.Int())
@@ -0,0 +1,132 @@
+package pb
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// anyTypeKey Any的type_url在结果中的key，与proto3的json映射一致
+	anyTypeKey = "@type"
+	// anyValueKey Any的value无法解析为message时在结果中的key
+	anyValueKey = "value"
+)
+
+// consumeAny 读取google.protobuf.Any中tag为1的type_url和tag为2的value
+// 出现其它字段或者类型不符时返回false
+func consumeAny(data []byte) (typeURL string, value []byte, ok bool) {
+	for len(data) > 0 {
+		num, typ, length := protowire.ConsumeTag(data)
+		if length < 0 || typ != protowire.BytesType {
+			return "", nil, false
+		}
+		data = data[length:]
+		field, length := protowire.ConsumeBytes(data)
+		if length < 0 {
+			return "", nil, false
+		}
+		data = data[length:]
+		switch num {
+		case 1:
+			if !utf8.Valid(field) {
+				return "", nil, false
+			}
+			typeURL = string(field)
+		case 2:
+			value = field
+		default:
+			return "", nil, false
+		}
+	}
+	return typeURL, value, true
+}
+
+// readAny 解析google.protobuf.Any，输出为 {"@type": "<type_url>", ...value中的字段}
+// value使用字段的嵌套选择解析，无法解析为message时输出为 {"@type": "<type_url>", "value": "<bytes>"}
+// 数据不符合Any的结构时按普通message解析
+// valueOpts: 字段的嵌套选择
+func readAny(st *decodeState, data []byte, tag uint64, valueOpts Options, result JSONResult) error {
+	typeURL, value, ok := consumeAny(data)
+	if !ok {
+		res, err := decode(st, data, valueOpts)
+		if err != nil {
+			return err
+		}
+		result.Append(fieldKey(Message, tag), res)
+		return nil
+	}
+
+	mark := st.outputMark()
+	res, err := decode(st.speculative(), value, valueOpts)
+	if err != nil {
+		if errors.Is(err, ErrBudgetExceeded) || errors.Is(err, ErrTooDeep) || st.cancelled() {
+			return err
+		}
+		st.resetOutput(mark)
+		_, encoded := st.bytesValue(value)
+		if err = st.countOutput(len(encoded)); err != nil {
+			return err
+		}
+		res = JSONResult{anyValueKey: encoded}
+	}
+	res[anyTypeKey] = typeURL
+	result.Append(fieldKey(Any, tag), res)
+	return nil
+}
+
+// encodeAny 将readAny输出的 {"@type": "<type_url>", ...} 序列化为google.protobuf.Any
+// value为 "value" 时按照bytes还原，bytes_encoding为base64时按照base64解析，否则按照十六进制解析，其余情况字段序列化为value的message
+// opts: 字段的嵌套选择，用于序列化value
+func encodeAny(st *encodeState, value interface{}, opts Options) ([]byte, error) {
+	msg, keys, ok := asMessage(value)
+	if !ok {
+		return nil, errInvalidValue
+	}
+	typeURL, ok := msg[anyTypeKey].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", errInvalidValue, anyTypeKey)
+	}
+	fields := make(map[string]interface{}, len(msg))
+	for k, v := range msg {
+		if k != anyTypeKey {
+			fields[k] = v
+		}
+	}
+	// 保持json中字段的顺序
+	var message interface{} = fields
+	if keys != nil {
+		ordered := NewOrderedResult()
+		for _, k := range keys {
+			if k != anyTypeKey {
+				ordered.Set(k, fields[k])
+			}
+		}
+		message = ordered
+	}
+	var data []byte
+	var err error
+	if s, ok := fields[anyValueKey].(string); ok && len(fields) == 1 {
+		if st.bytesBase64 {
+			data, err = base64.StdEncoding.DecodeString(s)
+		} else {
+			data, err = hex.DecodeString(s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidValue, err)
+		}
+	} else if data, err = encodeMessage(st, nil, message, opts); err != nil {
+		return nil, err
+	}
+	buf := protowire.AppendTag(nil, 1, protowire.BytesType)
+	buf = protowire.AppendString(buf, typeURL)
+	if len(data) > 0 {
+		buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, data)
+	}
+	return buf, nil
+}
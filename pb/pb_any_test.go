@@ -0,0 +1,84 @@
+package pb
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// anyMessage 构造google.protobuf.Any
+func anyMessage(typeURL string, value []byte) []byte {
+	buf := protowire.AppendTag(nil, 1, protowire.BytesType)
+	buf = protowire.AppendString(buf, typeURL)
+	buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+	return protowire.AppendBytes(buf, value)
+}
+
+func TestEncodeAnyRoundTrip(t *testing.T) {
+	var value []byte
+	value = protowire.AppendTag(value, 1, protowire.VarintType)
+	value = protowire.AppendVarint(value, 42)
+
+	tests := []struct {
+		name  string
+		value []byte
+		want  string
+	}{
+		{"message value", value, `{"1_any":{"1_varint":42,"@type":"type.googleapis.com/foo.Bar"}}`},
+		{"bytes value", []byte{0xff, 0xff}, `{"1_any":{"@type":"type.googleapis.com/foo.Bar","value":"ffff"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := protowire.AppendTag(nil, 1, protowire.BytesType)
+			raw = protowire.AppendBytes(raw, anyMessage("type.googleapis.com/foo.Bar", tt.value))
+			js, err := Decode(raw, Options{"1": "any"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if js != tt.want {
+				t.Fatalf("decode got %s, want %s", js, tt.want)
+			}
+			encoded, err := Encode(js)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(encoded, raw) {
+				t.Errorf("encode got %x, want %x", encoded, raw)
+			}
+		})
+	}
+}
+
+func TestEncodeAnyBytesEncoding(t *testing.T) {
+	// 0x69 0xb7 0x1d无法解析为message，按照bytes输出，base64编码为abcd
+	value := []byte{0x69, 0xb7, 0x1d}
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"hex", Options{"1": "any"}, `{"1_any":{"@type":"type.googleapis.com/foo.Bar","value":"69b71d"}}`},
+		{"base64", Options{"1": "any", OptionBytesEncoding: BytesEncodingBase64}, `{"1_any":{"@type":"type.googleapis.com/foo.Bar","value":"abcd"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := protowire.AppendTag(nil, 1, protowire.BytesType)
+			raw = protowire.AppendBytes(raw, anyMessage("type.googleapis.com/foo.Bar", value))
+			js, err := Decode(raw, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if js != tt.want {
+				t.Fatalf("decode got %s, want %s", js, tt.want)
+			}
+			encoded, err := EncodeWithOptions(js, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(encoded, raw) {
+				t.Errorf("encode got %x, want %x", encoded, raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package pb
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// DefaultMaxFields 默认的所有层级的字段总数的最大值
+	DefaultMaxFields = 1 << 20
+	// DefaultMaxOutputBytes 默认的估算的输出最大字节数
+	DefaultMaxOutputBytes = 256 << 20
+	// fieldOutputCost 每个字段的key、引号、冒号和逗号的估算输出字节数
+	fieldOutputCost = 16
+	// scalarOutputCost 数值类型的值的估算输出字节数
+	scalarOutputCost = 20
+	// packedOutputFactor packed类型每个输入字节的估算输出字节数
+	packedOutputFactor = 4
+	// minRatioOutputBytes 估算输出超过该值后才检查输出与输入的比值，避免很小的数据误判
+	minRatioOutputBytes = 4096
+)
+
+var (
+	// ErrBudgetExceeded 解析的输出超出了预算
+	ErrBudgetExceeded = errors.New("decode budget exceeded")
+)
+
+// Budget 解析的输出预算，防止很小的输入产生巨大的输出(放大攻击)
+// 输出字节数是解析过程中的估算值，大字符串和bytes也会计入
+type Budget struct {
+	// MaxOutputBytes 估算的输出最大字节数，0表示使用全局选择max_output_bytes或者DefaultMaxOutputBytes
+	// 需要不限制时将全局选择max_output_bytes设置为0
+	MaxOutputBytes int
+	// MaxRatio 估算的输出与输入字节数的最大比值，0表示不限制
+	MaxRatio float64
+	// MaxFields 所有层级的字段总数的最大值，0表示使用全局选择max_fields或者DefaultMaxFields
+	// 需要不限制时将全局选择max_fields设置为0
+	MaxFields int
+}
+
+// budgetCounter 解析过程中的输出估算，推测解析时与外层共享
+type budgetCounter struct {
+	budget Budget
+	// input 输入的字节数
+	input int
+	// output 当前估算的输出字节数
+	output int
+	// fields 当前已经输出的字段总数
+	fields int
+}
+
+// budgetMark 预算的使用量，推测解析失败时用于回滚
+type budgetMark struct {
+	output int
+	fields int
+}
+
+// newBudgetCounter 根据全局选择max_fields和max_output_bytes创建预算，都为0时返回nil
+func newBudgetCounter(raw []byte, opts Options) *budgetCounter {
+	budget := Budget{
+		MaxOutputBytes: opts.getInt(OptionMaxOutputBytes, DefaultMaxOutputBytes),
+		MaxFields:      opts.getInt(OptionMaxFields, DefaultMaxFields),
+	}
+	if budget.MaxOutputBytes <= 0 && budget.MaxFields <= 0 {
+		return nil
+	}
+	return &budgetCounter{budget: budget, input: len(raw)}
+}
+
+// add 增加估算的输出字节数，超出预算时返回错误
+func (c *budgetCounter) add(n int) error {
+	if c == nil {
+		return nil
+	}
+	c.output += n
+	if c.budget.MaxOutputBytes > 0 && c.output > c.budget.MaxOutputBytes {
+		return fmt.Errorf("%w: max output bytes %d", ErrBudgetExceeded, c.budget.MaxOutputBytes)
+	}
+	if c.budget.MaxRatio > 0 && c.output > minRatioOutputBytes &&
+		float64(c.output) > c.budget.MaxRatio*float64(c.input) {
+		return fmt.Errorf("%w: max output/input ratio %v", ErrBudgetExceeded, c.budget.MaxRatio)
+	}
+	return nil
+}
+
+// addField 增加一个字段，超出字段总数时返回错误
+func (c *budgetCounter) addField() error {
+	if c == nil {
+		return nil
+	}
+	c.fields++
+	if c.budget.MaxFields > 0 && c.fields > c.budget.MaxFields {
+		return fmt.Errorf("%w: max fields %d", ErrBudgetExceeded, c.budget.MaxFields)
+	}
+	return nil
+}
+
+// DecodeWithBudget 在输出预算内将PB二进制数据反序列化为json数据，超出预算时返回ErrBudgetExceeded
+// budget中为0的限制使用全局选择max_fields和max_output_bytes或者默认值
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+// budget: 输出预算
+func DecodeWithBudget(raw []byte, opts Options, budget Budget) (string, error) {
+	st := newDecodeState(raw, opts)
+	if st.budget != nil {
+		if budget.MaxOutputBytes == 0 {
+			budget.MaxOutputBytes = st.budget.budget.MaxOutputBytes
+		}
+		if budget.MaxFields == 0 {
+			budget.MaxFields = st.budget.budget.MaxFields
+		}
+	}
+	st.budget = &budgetCounter{budget: budget, input: len(raw)}
+	res, err := decode(st, raw, opts)
+	if err != nil {
+		return "", err
+	}
+	return marshalResult(st, res, opts)
+}
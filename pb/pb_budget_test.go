@@ -0,0 +1,45 @@
+package pb
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestDecodeWithBudget(t *testing.T) {
+	var raw []byte
+	for i := 0; i < 10; i++ {
+		raw = protowire.AppendVarint(protowire.AppendTag(raw, 1, protowire.VarintType), 1)
+	}
+	tests := []struct {
+		name    string
+		opts    Options
+		budget  Budget
+		wantErr bool
+	}{
+		{"zero uses default", nil, Budget{}, false},
+		{"zero uses global option", Options{OptionMaxFields: 5}, Budget{}, true},
+		{"budget overrides global option", Options{OptionMaxFields: 5}, Budget{MaxFields: 20}, false},
+		{"global option zero is unlimited", Options{OptionMaxFields: 0, OptionMaxOutputBytes: 0}, Budget{}, false},
+		{"max output bytes", nil, Budget{MaxOutputBytes: 64}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeWithBudget(raw, tt.opts, tt.budget)
+			if gotErr := errors.Is(err, ErrBudgetExceeded); gotErr != tt.wantErr {
+				t.Errorf("got %v, want budget exceeded %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 输出与输入的比值，0表示不限制
+	large := protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), bytes.Repeat([]byte{0xff}, 8192))
+	if _, err := DecodeWithBudget(large, nil, Budget{}); err != nil {
+		t.Errorf("zero ratio: got %v, want nil", err)
+	}
+	if _, err := DecodeWithBudget(large, nil, Budget{MaxRatio: 1.5}); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("ratio: got %v, want %v", err, ErrBudgetExceeded)
+	}
+}
@@ -0,0 +1,141 @@
+package pb
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// errNoCandidates 没有候选的选择
+	errNoCandidates = errors.New("no candidate options")
+)
+
+// CandidateStats 使用一组候选选择解析的统计信息，用于评分
+type CandidateStats struct {
+	// Fields 输出的字段数，数组的每个元素都计数，包括嵌套类型中的字段
+	Fields int `json:"fields"`
+	// Guessed 选择中没有指定类型、通过推测得到类型的字段数
+	Guessed int `json:"guessed"`
+	// HexBytes 以十六进制输出的bytes字段的字符数
+	HexBytes int `json:"hex_bytes"`
+	// OutputBytes 输出的json的字节数
+	OutputBytes int `json:"output_bytes"`
+	// Err 解析失败时的错误
+	Err error `json:"-"`
+}
+
+// CandidateResult 一组候选选择的解析结果
+type CandidateResult struct {
+	// Index 候选选择在参数中的下标
+	Index int `json:"index"`
+	// Options 候选选择
+	Options Options `json:"options"`
+	// JSON 解析结果，解析失败时为空
+	JSON string `json:"json"`
+	// Stats 统计信息
+	Stats CandidateStats `json:"stats"`
+	// Score 评分，越高越好
+	Score float64 `json:"score"`
+}
+
+// CandidateScorer 根据统计信息为解析结果评分，分数越高表示解析结果越可信
+type CandidateScorer func(stats CandidateStats) float64
+
+// DefaultCandidateScorer 默认的评分函数
+// 解析失败为-1，否则为 1 - 0.5*推测字段比例 - 0.5*十六进制输出占比，没有字段时为0
+// 即指定了类型的字段越多、无法解释的bytes越少分数越高
+func DefaultCandidateScorer(stats CandidateStats) float64 {
+	if stats.Err != nil {
+		return -1
+	}
+	if stats.Fields == 0 || stats.OutputBytes == 0 {
+		return 0
+	}
+	guessed := float64(stats.Guessed) / float64(stats.Fields)
+	hexRatio := float64(stats.HexBytes) / float64(stats.OutputBytes)
+	return 1 - 0.5*guessed - 0.5*hexRatio
+}
+
+// DecodeCandidates 使用多组候选选择解析同一份数据，返回按默认评分从高到低排序的结果
+// 单个候选解析失败不会返回错误，失败原因记录在Stats.Err中
+// raw: 要进行反序列化的PB数据
+// candidates: 候选的用户选择
+func DecodeCandidates(raw []byte, candidates []Options) ([]CandidateResult, error) {
+	return DecodeCandidatesWithScorer(raw, candidates, DefaultCandidateScorer)
+}
+
+// DecodeCandidatesWithScorer 与DecodeCandidates相同，使用scorer评分
+func DecodeCandidatesWithScorer(raw []byte, candidates []Options, scorer CandidateScorer) ([]CandidateResult, error) {
+	if len(candidates) == 0 {
+		return nil, errNoCandidates
+	}
+	if scorer == nil {
+		scorer = DefaultCandidateScorer
+	}
+	results := make([]CandidateResult, 0, len(candidates))
+	for i, opts := range candidates {
+		result := CandidateResult{Index: i, Options: opts}
+		st := newDecodeState(raw, opts)
+		res, err := decode(st, raw, opts)
+		if err == nil {
+			countCandidateStats(res, opts, &result.Stats)
+			result.JSON, err = marshalResult(st, res, opts)
+			result.Stats.OutputBytes = len(result.JSON)
+		}
+		result.Stats.Err = err
+		result.Score = scorer(result.Stats)
+		results = append(results, result)
+	}
+	// 分数相同时保持候选的顺序
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results, nil
+}
+
+// countCandidateStats 统计解析结果中的字段，需要在修复TagType名称之前调用
+func countCandidateStats(res JSONResult, opts Options, stats *CandidateStats) {
+	for k, v := range res {
+		tag := strconv.FormatUint(keyTag(k), 10)
+		guessed := opts.GetTypeByTag(tag) == Unkown && opts[GetOptionsKey(tag)] == nil
+		nested := opts.GetOptionsByTag(tag)
+		if guessed {
+			// 推测的嵌套类型使用当前层级的选择
+			nested = opts.inherited()
+		}
+		items, ok := v.([]interface{})
+		if !ok {
+			items = []interface{}{v}
+		}
+		for _, item := range items {
+			stats.Fields++
+			if guessed {
+				stats.Guessed++
+			}
+			switch value := item.(type) {
+			case JSONResult:
+				countCandidateStats(value, nested, stats)
+			case string:
+				if strings.HasSuffix(k, "_bytes") {
+					stats.HexBytes += len(value)
+				}
+			}
+		}
+	}
+}
+
+// MarshalJSON 输出错误信息
+func (s CandidateStats) MarshalJSON() ([]byte, error) {
+	type stats CandidateStats
+	var errText string
+	if s.Err != nil {
+		errText = s.Err.Error()
+	}
+	return json.Marshal(struct {
+		stats
+		Error string `json:"error,omitempty"`
+	}{stats(s), errText})
+}
@@ -0,0 +1,150 @@
+package pb
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+)
+
+// 终端颜色的ANSI转义序列
+const (
+	colorReset   = "\x1b[0m"
+	colorTag     = "\x1b[36m"
+	colorType    = "\x1b[33m"
+	colorString  = "\x1b[32m"
+	colorNumber  = "\x1b[35m"
+	colorLiteral = "\x1b[34m"
+)
+
+// ColorEnabled 判断输出到f时是否使用颜色
+// 设置了NO_COLOR环境变量或者f不是终端时不使用颜色
+func ColorEnabled(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// DecodeColor 将PB二进制数据反序列化后以缩进的json格式输出到w
+// tag、类型名称和值使用不同的颜色，color为false时输出普通的缩进json
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+func DecodeColor(w io.Writer, raw []byte, opts Options, color bool) error {
+	res, err := decode(newDecodeState(raw, opts), raw, opts)
+	if err != nil {
+		return err
+	}
+	res.FixTagTypeNamesWithOptions(opts)
+
+	cw := &colorWriter{w: bufio.NewWriter(w), color: color}
+	if err := cw.writeValue(map[string]interface{}(res), 0); err != nil {
+		return err
+	}
+	cw.w.WriteString("\n")
+	return cw.w.Flush()
+}
+
+// colorWriter 输出带颜色的json
+type colorWriter struct {
+	w     *bufio.Writer
+	color bool
+}
+
+// paint 输出带颜色的文本
+func (c *colorWriter) paint(color, s string) {
+	if c.color {
+		c.w.WriteString(color)
+		c.w.WriteString(s)
+		c.w.WriteString(colorReset)
+		return
+	}
+	c.w.WriteString(s)
+}
+
+// writeKey 输出key，tag_type 格式的key中tag和类型名称使用不同的颜色
+func (c *colorWriter) writeKey(key string) {
+	idx := strings.IndexByte(key, '_')
+	if idx <= 0 || keyTag(key) == 0 {
+		c.paint(colorType, quoteJSON(key))
+	} else {
+		c.paint(colorTag, "\""+key[:idx])
+		c.w.WriteString("_")
+		c.paint(colorType, key[idx+1:]+"\"")
+	}
+	c.w.WriteString(": ")
+}
+
+// writeValue 输出一个值
+func (c *colorWriter) writeValue(value interface{}, depth int) error {
+	indent := strings.Repeat("  ", depth+1)
+	switch v := value.(type) {
+	case JSONResult:
+		return c.writeValue(map[string]interface{}(v), depth)
+	case map[string]interface{}:
+		if len(v) == 0 {
+			c.w.WriteString("{}")
+			return nil
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sortKeysByTag(keys)
+		c.w.WriteString("{\n")
+		for i, k := range keys {
+			c.w.WriteString(indent)
+			c.writeKey(k)
+			if err := c.writeValue(v[k], depth+1); err != nil {
+				return err
+			}
+			if i < len(keys)-1 {
+				c.w.WriteString(",")
+			}
+			c.w.WriteString("\n")
+		}
+		c.w.WriteString(strings.Repeat("  ", depth) + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			c.w.WriteString("[]")
+			return nil
+		}
+		c.w.WriteString("[\n")
+		for i, item := range v {
+			c.w.WriteString(indent)
+			if err := c.writeValue(item, depth+1); err != nil {
+				return err
+			}
+			if i < len(v)-1 {
+				c.w.WriteString(",")
+			}
+			c.w.WriteString("\n")
+		}
+		c.w.WriteString(strings.Repeat("  ", depth) + "]")
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		switch v.(type) {
+		case string:
+			c.paint(colorString, string(data))
+		case bool, nil:
+			c.paint(colorLiteral, string(data))
+		default:
+			c.paint(colorNumber, string(data))
+		}
+	}
+	return nil
+}
+
+// quoteJSON 将字符串转换为json字符串
+func quoteJSON(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
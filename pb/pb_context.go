@@ -0,0 +1,27 @@
+package pb
+
+import (
+	"context"
+)
+
+// DecodeContext 将PB二进制数据反序列化为json数据，解析过程中定期检查ctx
+// ctx取消或超时时提前返回ctx.Err()
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+func DecodeContext(ctx context.Context, raw []byte, opts Options) (string, error) {
+	st := newDecodeState(raw, opts)
+	st.ctx = ctx
+	res, err := decode(st, raw, opts)
+	if err != nil {
+		return "", contextErr(ctx, err)
+	}
+	return marshalResult(st, res, opts)
+}
+
+// contextErr ctx取消或超时导致的解析失败返回ctx.Err()，而不是包含字段位置的DecodeError
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package pb
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// errMessageNotFound 找不到对应tag的message字段
+	errMessageNotFound = errors.New("message field not found")
+)
+
+// DecodeRepeatedCSV 将PB二进制数据中指定tag的repeated message输出为CSV
+// 第一行为所有元素字段名称的并集，每个元素一行，缺少的字段为空，嵌套类型和数组以json输出
+// raw: 要进行反序列化的PB数据
+// tag: repeated message字段的tag
+// opts: 用户针对每个字段的干预选择
+func DecodeRepeatedCSV(raw []byte, tag uint64, opts Options) (string, error) {
+	res, err := decode(newDecodeState(raw, opts), raw, opts)
+	if err != nil {
+		return "", err
+	}
+
+	var items []interface{}
+	switch value := res[fieldKey(Message, tag)].(type) {
+	case []interface{}:
+		items = value
+	case JSONResult:
+		items = []interface{}{value}
+	default:
+		return "", fmt.Errorf("%w: %d", errMessageNotFound, tag)
+	}
+
+	// 收集所有元素的字段作为表头
+	itemOpts := opts.GetOptionsByTag(strconv.FormatUint(tag, 10))
+	rows := make([]JSONResult, 0, len(items))
+	header := []string{}
+	seen := map[string]bool{}
+	for _, item := range items {
+		row, ok := item.(JSONResult)
+		if !ok {
+			return "", fmt.Errorf("%w: %d", errMessageNotFound, tag)
+		}
+		row.FixTagTypeNamesWithOptions(itemOpts)
+		for k := range row {
+			if !seen[k] {
+				seen[k] = true
+				header = append(header, k)
+			}
+		}
+		rows = append(rows, row)
+	}
+	sortKeysByTag(header)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(header); err != nil {
+		return "", err
+	}
+	for _, row := range rows {
+		record := make([]string, len(header))
+		for i, k := range header {
+			if record[i], err = csvCell(row[k]); err != nil {
+				return "", err
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// csvCell 将字段值转换为CSV单元格，嵌套类型和数组使用json
+func csvCell(value interface{}) (string, error) {
+	switch value.(type) {
+	case nil:
+		return "", nil
+	case JSONResult, []interface{}:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// sortKeysByTag 按照key中的tag数值排序，tag相同时按key排序
+func sortKeysByTag(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		ti, tj := keyTag(keys[i]), keyTag(keys[j])
+		if ti != tj {
+			return ti < tj
+		}
+		return keys[i] < keys[j]
+	})
+}
+
+// keyTag 获取 tag_type 格式的key中的tag，解析失败返回0
+func keyTag(key string) uint64 {
+	if idx := strings.IndexByte(key, '_'); idx >= 0 {
+		key = key[:idx]
+	}
+	tag, _ := strconv.ParseUint(key, 10, 64)
+	return tag
+}
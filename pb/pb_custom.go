@@ -0,0 +1,31 @@
+package pb
+
+import (
+	"fmt"
+)
+
+// CustomDecoder 自定义的字段解析函数，返回的值直接输出到结果中
+// bytes字段的raw为去掉长度前缀的数据，varint字段的raw为varint编码的原始数据
+type CustomDecoder func(raw []byte) (interface{}, error)
+
+// customDecoder 获取当前层级tag对应的自定义解析函数，没有则返回nil
+// 如 Options{OptionCustomDecoders: map[string]CustomDecoder{"9": gunzip}}
+func (o Options) customDecoder(tag string) CustomDecoder {
+	switch decoders := o[OptionCustomDecoders].(type) {
+	case map[string]CustomDecoder:
+		return decoders[tag]
+	case map[string]func([]byte) (interface{}, error):
+		return decoders[tag]
+	}
+	return nil
+}
+
+// readCustom 使用自定义的解析函数解析字段，结果的key为 tag_custom
+func readCustom(decoder CustomDecoder, data []byte, tag uint64, result JSONResult) error {
+	value, err := decoder(data)
+	if err != nil {
+		return fmt.Errorf("custom decoder: %w", err)
+	}
+	result.Append(fieldKey(Custom, tag), value)
+	return nil
+}
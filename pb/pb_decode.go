@@ -1,12 +1,14 @@
 package pb
 
 import (
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
+	"time"
+	"unicode/utf8"
 
 	"google.golang.org/protobuf/encoding/protowire"
 )
@@ -30,6 +32,10 @@ var (
 	errPBTagTooBig = errors.New("pb's tag too big")
 	// errUnknownType 未知的PB类型
 	errUnknownType = errors.New("unknown type")
+	// errInvalidHeaderLen 头部长度不合法
+	errInvalidHeaderLen = errors.New("invalid header length")
+	// errCountMismatch count_prefixed数据中的元素个数与实际不一致
+	errCountMismatch = errors.New("element count mismatch")
 )
 
 // FieldMeta 保存Protobuf字段序列化或者反序列化的元数据
@@ -41,30 +47,44 @@ type FieldMeta struct {
 }
 
 // readTagType 从序列化后的二进制数据中读取tag和type，并且返回剩余的数据
-func readTagType(raw []byte) (tagType *FieldMeta, rest []byte, err error) {
+// 返回值而不是指针，避免每个字段的堆分配
+// maxTag: 支持的tag最大值
+func readTagType(raw []byte, maxTag uint64) (tagType FieldMeta, rest []byte, err error) {
 	tag, typ, length := protowire.ConsumeTag(raw)
 	if length < 0 {
-		return nil, nil, protowire.ParseError(length)
+		return FieldMeta{}, nil, protowire.ParseError(length)
 	}
-	if tag > MaxTagValue {
-		return nil, nil, errPBTagTooBig
+	if uint64(tag) > maxTag {
+		return FieldMeta{}, nil, fmt.Errorf("%w: %d > %d", errPBTagTooBig, tag, maxTag)
 	}
 
-	tagType = &FieldMeta{
+	tagType = FieldMeta{
 		Tag:  uint64(tag),
 		Type: Type(typ),
 	}
 	return tagType, raw[length:], nil
 }
 
-// isString 判断raw中的二进制数据是否是字符串. 根据其中是否有控制字符来判断
-// 有控制字符则代表是不是字符串
-func isString(raw []byte) bool {
+// fieldKey 生成结果中字段的key，与fmt.Sprintf(typeNamesFormat[typ], tag)相同，避免格式化的开销
+// 没有名称的类型返回空字符串
+func fieldKey(typ Type, tag uint64) string {
+	format, ok := typeNamesFormat[typ]
+	if !ok {
+		return ""
+	}
+	return strconv.FormatUint(tag, 10) + format[len("%d"):]
+}
 
+// isString 判断raw中的二进制数据是否是字符串. 根据其中是否有控制字符以及是否是合法的UTF-8来判断
+// 有控制字符或者不是合法的UTF-8则代表是不是字符串
+func isString(raw []byte) bool {
+	if !utf8.Valid(raw) {
+		return false
+	}
 	for _, c := range raw {
 		if c == HorizontalTab || c == NewLineChar || c == CarriageReturn {
 			// 水平制表符、换行符和回车符认为是合法字符串字符
-			return true
+			continue
 		} else if c == DeleteChar {
 			// 删除符认为是非法字符串字符
 			return false
@@ -75,120 +95,428 @@ func isString(raw []byte) bool {
 	return true
 }
 
+// escapePrintable 将二进制数据转换为可读的字符串，类似python的repr
+// 可打印的ASCII字符原样保留，反斜杠和单引号加反斜杠转义，
+// 制表符、换行符和回车符转义为\t、\n、\r，其它字符转义为\xNN
+func escapePrintable(raw []byte) string {
+	const hexDigits = "0123456789abcdef"
+	buf := make([]byte, 0, len(raw))
+	for _, c := range raw {
+		switch {
+		case c == '\\' || c == '\'':
+			buf = append(buf, '\\', c)
+		case c == HorizontalTab:
+			buf = append(buf, '\\', 't')
+		case c == NewLineChar:
+			buf = append(buf, '\\', 'n')
+		case c == CarriageReturn:
+			buf = append(buf, '\\', 'r')
+		case c > MaxCtrlChar && c < DeleteChar:
+			buf = append(buf, c)
+		default:
+			buf = append(buf, '\\', 'x', hexDigits[c>>4], hexDigits[c&0xF])
+		}
+	}
+	return string(buf)
+}
+
 // DecodeInterface 将PB二进制数据反序列化为map[string]interface{}数据
 // raw: 要进行反序列化的PB数据
 // opts: 用户针对每个字段的干预选择
 func DecodeInterface(raw []byte, opts Options) (map[string]interface{}, error) {
-	res, err := decode(raw, opts)
+	res, err := decode(newDecodeState(raw, opts), raw, opts)
 	if err != nil {
 		return nil, err
 	}
-	res.FixTagTypeNames()
-	return map[string]interface{}(res), nil
+	return finishResult(res, opts), nil
 }
 
 // Decode 将PB二进制数据反序列化为json数据
 // raw: 要进行反序列化的PB数据
 // opts: 用户针对每个字段的干预选择
 func Decode(raw []byte, opts Options) (string, error) {
-	res, err := decode(raw, opts)
+	st := newDecodeState(raw, opts)
+	res, err := decode(st, raw, opts)
 	if err != nil {
 		return "", err
 	}
+	return marshalResult(st, res, opts)
+}
 
-	res.FixTagTypeNames()
-
-	data, err := json.Marshal(res)
+// marshalResult 修复TagType名称后将解析结果序列化为json
+// st记录了字段顺序时按照字段出现的顺序输出，st可以为nil
+func marshalResult(st *decodeState, res JSONResult, opts Options) (string, error) {
+	var out interface{}
+	if st != nil && st.orders != nil && !opts.getBool(OptionStructuredKeys) {
+		res.FixTagTypeNamesWithOptions(opts)
+		out = st.orderedResult(res, opts.KeyFormatter())
+	} else {
+		out = finishResult(res, opts)
+	}
+	data, err := json.Marshal(out)
 	if err != nil {
 		return "", err
 	}
 	return string(data), nil
 }
 
+// finishResult 修复TagType名称，全局选择structured_keys为true时转换为结构化的字段
+func finishResult(res JSONResult, opts Options) map[string]interface{} {
+	if opts.getBool(OptionStructuredKeys) {
+		return structuredResult(res)
+	}
+	res.FixTagTypeNamesWithOptions(opts)
+	if f := opts.KeyFormatter(); f != nil {
+		return formatKeys(res, f)
+	}
+	return res
+}
+
+// DecodeWithHeader 去掉固定长度的头部(魔数、版本、标志位等)后将PB二进制数据反序列化为json数据
+// raw: 带头部的PB数据
+// headerLen: 头部的长度
+// opts: 用户针对每个字段的干预选择
+// 返回头部数据和解析结果，头部返回原始字节而不是十六进制字符串，调用方可以直接解析其中的版本、标志位等
+// 头部与raw共享底层数组，需要展示时使用hex.EncodeToString
+func DecodeWithHeader(raw []byte, headerLen int, opts Options) (header []byte, js string, err error) {
+	if headerLen < 0 || headerLen > len(raw) {
+		return nil, "", fmt.Errorf("%w: %d, data length: %d", errInvalidHeaderLen, headerLen, len(raw))
+	}
+	js, err = Decode(raw[headerLen:], opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return raw[:headerLen], js, nil
+}
+
 // decode 将PB二进制数据反序列化为json数据格式的JSONResult
+// st: 本次解析共享的状态
 // raw: 要进行反序列化的PB数据
 // opts: 用户针对每个字段的干预选择
-func decode(raw []byte, opts Options) (JSONResult, error) {
+func decode(st *decodeState, raw []byte, opts Options) (JSONResult, error) {
+	if err := st.enter(); err != nil {
+		return nil, err
+	}
+	defer st.leave()
 
-	result := JSONResult{}
+	d := newMessageDecoder(st, opts, st.sizeHint(raw))
 	var err error
 	for len(raw) > 0 {
-		// 读取tag和type
-		var tagType *FieldMeta
-		tagType, raw, err = readTagType(raw)
-		if err != nil {
+		if err = st.checkContext(); err != nil {
 			return nil, err
 		}
+		if raw, err = d.field(raw); err != nil {
+			// 选择了best_effort时顶层message保留已经解析的字段，嵌套的message仍然返回错误，
+			// 以免影响推测嵌套类型
+			if st.bestEffort && st.depth == 1 && !st.cancelled() {
+				return d.partial(err)
+			}
+			return nil, err
+		}
+	}
+	return d.finish()
+}
+
+// partial 停止解析，返回已经解析的字段，错误信息记录在ErrorKey中
+func (d *messageDecoder) partial(err error) (JSONResult, error) {
+	res, ferr := d.finish()
+	if ferr != nil {
+		return nil, err
+	}
+	info := map[string]interface{}{"error": err.Error()}
+	var de *DecodeError
+	if errors.As(err, &de) {
+		info["offset"] = de.Offset
+		if len(de.Path) > 0 {
+			info["path"] = de.PathString()
+		}
+	}
+	res[ErrorKey] = info
+	return res, nil
+}
+
+// messageDecoder 解析一个message中的字段，字段可以分多次输入
+type messageDecoder struct {
+	st     *decodeState
+	opts   Options
+	result JSONResult
+	// chunks 需要合并的bytes字段的数据，按照在数据中出现的顺序拼接
+	chunks    map[uint64][]byte
+	chunkTags []uint64
+	// pending 需要根据判别字段选择解析方式的bytes字段
+	pending []pendingField
+	// order 字段第一次出现的顺序，选择了ordered时记录
+	order []uint64
+	seen  map[uint64]struct{}
+}
+
+// newMessageDecoder 创建message的解析器，size为预计的字段数
+func newMessageDecoder(st *decodeState, opts Options, size int) *messageDecoder {
+	return &messageDecoder{
+		st:     st,
+		opts:   opts,
+		result: make(JSONResult, size),
+	}
+}
+
+// field 解析raw开头的一个字段，返回剩余的数据
+// 需要合并或者等待判别字段的bytes字段会引用raw中的数据，直到finish之前raw都不能被修改
+func (d *messageDecoder) field(raw []byte) ([]byte, error) {
+	st, opts, result := d.st, d.opts, d.result
+	field := raw
+	// 读取tag和type
+	tagType, raw, err := readTagType(raw, st.maxTag)
+	if err != nil {
+		return nil, &DecodeError{Offset: st.offset(field), Err: err}
+	}
+
+	// 不需要输出的字段只读取不输出
+	if !opts.allowTag(tagType.Tag) {
+		length := protowire.ConsumeFieldValue(protowire.Number(tagType.Tag), protowire.Type(tagType.Type), raw)
+		if length < 0 {
+			return nil, wrapFieldError(tagType.Tag, st.offset(field), protowire.ParseError(length))
+		}
+		return raw[length:], nil
+	}
+	if st.orders != nil {
+		d.recordTag(tagType.Tag)
+	}
 
-		switch tagType.Type {
-		case Varint:
-			raw, err = readVarint(raw, tagType.Tag, opts, result)
-		case Bytes:
-			data, length := protowire.ConsumeBytes(raw)
-			if length < 0 {
-				return nil, protowire.ParseError(length)
+	cost := fieldOutputCost
+	if tagType.Type != Bytes {
+		cost += scalarOutputCost
+	}
+	if err = st.countOutput(cost); err != nil {
+		return nil, wrapFieldError(tagType.Tag, st.offset(field), err)
+	}
+	if err = st.countField(); err != nil {
+		return nil, wrapFieldError(tagType.Tag, st.offset(field), err)
+	}
+
+	switch tagType.Type {
+	case Varint:
+		raw, err = readVarint(st, raw, tagType.Tag, opts, result)
+	case Bytes:
+		data, length := protowire.ConsumeBytes(raw)
+		if length < 0 {
+			return nil, wrapFieldError(tagType.Tag, st.offset(field), protowire.ParseError(length))
+		}
+		raw = raw[length:]
+		if opts.isCoalesced(tagType.Tag) {
+			if d.chunks == nil {
+				d.chunks = map[uint64][]byte{}
 			}
-			raw = raw[length:]
-			err = readBytes(data, tagType.Tag, opts, result)
-		case Fixed32:
-			raw, err = readFixed32(raw, tagType.Tag, opts, result)
-		case Fixed64:
-			raw, err = readFixed64(raw, tagType.Tag, opts, result)
-		default:
-			return nil, errUnknownType
+			if _, ok := d.chunks[tagType.Tag]; !ok {
+				d.chunkTags = append(d.chunkTags, tagType.Tag)
+			}
+			d.chunks[tagType.Tag] = append(d.chunks[tagType.Tag], data...)
+			break
 		}
+		if _, ok := opts.discriminatorOf(tagType.Tag); ok {
+			d.pending = append(d.pending, pendingField{tag: tagType.Tag, data: data})
+			break
+		}
+		err = readBytes(st, data, tagType.Tag, opts, result)
+	case Fixed32:
+		raw, err = readFixed32(st, raw, tagType.Tag, opts, result)
+	case Fixed64:
+		raw, err = readFixed64(st, raw, tagType.Tag, opts, result)
+	case StartGroup:
+		raw, err = readGroup(st, raw, tagType.Tag, opts, result)
+	case EndGroup:
+		// 对应的EndGroup在readGroup中消耗，这里出现说明没有对应的StartGroup
+		if !st.skipUnknownWire {
+			return nil, wrapFieldError(tagType.Tag, st.offset(field), errUnexpectedEndGroup)
+		}
+		raw = st.skip(field, "unexpected end group")
+	default:
+		if !st.skipUnknownWire {
+			return nil, wrapFieldError(tagType.Tag, st.offset(field), errUnknownType)
+		}
+		// 跳过无法识别的数据，尝试在后面找到合法的字段继续解析
+		raw = st.skip(field, fmt.Sprintf("unknown wire type %d", tagType.Type))
+	}
+	if err != nil {
+		return nil, wrapFieldError(tagType.Tag, st.offset(field), err)
+	}
+	return raw, nil
+}
 
-		if err != nil {
-			return nil, err
+// finish 解析合并的和等待判别字段的bytes字段，并对结果进行后处理
+func (d *messageDecoder) finish() (JSONResult, error) {
+	st, opts, result := d.st, d.opts, d.result
+	// 合并后的bytes字段作为一个值输出
+	for _, tag := range d.chunkTags {
+		// 拼接后的数据不在原始数据中，偏移为拼接后数据中的偏移
+		chunk := d.chunks[tag]
+		cst := *st
+		cst.rootCap, cst.base = cap(chunk), 0
+		if err := readBytes(&cst, chunk, tag, opts, result); err != nil {
+			return nil, wrapFieldError(tag, 0, err)
 		}
 	}
+	if err := readDiscriminated(st, d.pending, opts, result); err != nil {
+		return nil, err
+	}
+	applyRepeated(result, opts)
+	// 先脱敏再转换key_by，避免脱敏的值作为key输出
+	applyRedact(st, result, opts)
+	if st.numbersAsStrings {
+		applyNumbersAsStrings(result)
+	}
+	applyKeyBy(result, opts)
+	groupExtensions(result, opts)
+	if st.orders != nil {
+		st.recordOrder(result, d.order)
+	}
 	return result, nil
 }
 
+// applyRepeated 选择了unpacked repeated类型的字段只出现一次时同样输出为数组
+func applyRepeated(result JSONResult, opts Options) {
+	for k, v := range result {
+		if _, ok := v.([]interface{}); ok {
+			continue
+		}
+		if opts.isRepeated(strconv.FormatUint(keyTag(k), 10)) {
+			result[k] = []interface{}{v}
+		}
+	}
+}
+
 // readVarint 解析varint类型
+// st: 本次解析共享的状态
 // raw: 要反序列化的PB数据
 // tag: 要反序列化的字段的tag
 // opts: 用户干预反序列化的选择
 // result: 反序列化的结果
-func readVarint(raw []byte, tag uint64, opts Options,
+func readVarint(st *decodeState, raw []byte, tag uint64, opts Options,
 	result JSONResult) ([]byte, error) {
 	value, length := protowire.ConsumeVarint(raw)
+	if length < 0 && isOverlongVarint(raw) {
+		if !st.lenientVarint {
+			return raw, fmt.Errorf("%w at offset %d for field %d", ErrOverlongVarint, st.offset(raw), tag)
+		}
+		st.warn(tag, raw, "overlong varint truncated to 64 bits")
+		value, length = consumeLenientVarint(raw)
+	}
 	if length < 0 {
 		return raw, protowire.ParseError(length)
 	}
+	data := raw[:length]
 	raw = raw[length:]
 
 	// 根据用户选择进行类型转换，默认Varint类型
-	typ := opts.GetTypeByTag(strconv.FormatUint(tag, 10))
-	typeName := fmt.Sprintf(typeNamesFormat[typ], tag)
+	sTag := strconv.FormatUint(tag, 10)
+	if decoder := opts.customDecoder(sTag); decoder != nil {
+		return raw, readCustom(decoder, data, tag, result)
+	}
+	typ := st.typeOf(opts, sTag)
+	var enum func(int32) interface{}
+	if isPacked(typ) {
+		// packed的repeated字段也可能以非packed的方式编码，按元素类型解析
+		typ -= Packed
+		enum = st.packedEnum(opts, sTag)
+	}
+	typeName := fieldKey(typ, tag)
+	var v interface{}
 	switch typ {
+	case Flags:
+		bits, _ := opts.getFieldOption(sTag)[fieldBitsKey].(map[string]interface{})
+		v = decodeFlags(value, bits)
+	case Enum:
+		v = enumValue(int32(value), opts.getFieldOption(sTag), st.enumBoth)
+	case TimestampS:
+		v = decodeTimestamp(int64(value), time.Second)
+	case TimestampMs:
+		v = decodeTimestamp(int64(value), time.Millisecond)
 	case Int32:
-		result.Append(typeName, int32(value))
+		// 负数的int32按照int64符号扩展编码为10字节的varint，取低32位即为原值
+		v = int32(value)
 	case Int64:
-		result.Append(typeName, int64(value))
+		v = st.numberFormat(opts, sTag).int64(int64(value), false)
 	case UInt:
-		result.Append(typeName, uint64(value))
+		v = st.numberFormat(opts, sTag).uint64(value, false)
 	case SInt:
-		result.Append(typeName, protowire.DecodeZigZag(value))
+		v = st.numberFormat(opts, sTag).int64(protowire.DecodeZigZag(value), false)
 	case Bool:
-		if value == 0 {
-			result.Append(typeName, false)
-			break
-		}
-		result.Append(typeName, true)
+		v = value != 0
 	default:
-		typeName = fmt.Sprintf(typeNamesFormat[Varint], tag)
-		result.Append(typeName, value)
+		typeName = fieldKey(Varint, tag)
+		v = st.numberFormat(opts, sTag).uint64(value, false)
+		if st.varintInterpretations {
+			v = varintInterpretations(value)
+		}
+	}
+	if enum != nil && int64(value) == int64(int32(value)) {
+		v = enum(int32(value))
 	}
+	v, err := transformValue(opts, sTag, v, st.numberFormat(opts, sTag))
+	if err != nil {
+		return raw, err
+	}
+	result.Append(typeName, v)
 	return raw, nil
 }
 
+// varintInterpretations 未指定类型的varint的各种可能的解释，bool只在值为0或1时出现
+// 返回普通的map而不是JSONResult，避免FixTagTypeNames修改其中的key
+func varintInterpretations(value uint64) map[string]interface{} {
+	v := map[string]interface{}{
+		"as_uint":  value,
+		"as_sint":  protowire.DecodeZigZag(value),
+		"as_int32": int32(value),
+		"as_int64": int64(value),
+	}
+	if value <= 1 {
+		v["as_bool"] = value == 1
+	}
+	return v
+}
+
+// decodeFlags 将varint按位解析为标志位名称的列表，同时保留原始值
+// bits: 位和名称的映射，没有映射的位输出为bit_N
+// 返回普通的map而不是JSONResult，避免FixTagTypeNames修改其中的key
+func decodeFlags(value uint64, bits map[string]interface{}) map[string]interface{} {
+	flags := []interface{}{}
+	for i := 0; i < 64; i++ {
+		if value&(1<<uint(i)) == 0 {
+			continue
+		}
+		name, ok := bits[strconv.Itoa(i)].(string)
+		if !ok {
+			name = fmt.Sprintf("bit_%d", i)
+		}
+		flags = append(flags, name)
+	}
+	return map[string]interface{}{
+		"value": value,
+		"flags": flags,
+	}
+}
+
+// timestampISOFormat 时间戳的ISO-8601格式，毫秒级时间戳保留毫秒
+const timestampISOFormat = "2006-01-02T15:04:05.999Z07:00"
+
+// decodeTimestamp 将unix时间戳转换为同时包含原始值和UTC的ISO-8601时间的对象
+func decodeTimestamp(value int64, unit time.Duration) map[string]interface{} {
+	t := time.Unix(value, 0)
+	if unit == time.Millisecond {
+		t = time.UnixMilli(value)
+	}
+	return map[string]interface{}{
+		"value": value,
+		"iso":   t.UTC().Format(timestampISOFormat),
+	}
+}
+
 // readBytes 解析bytes类型
+// st: 本次解析共享的状态
 // data: 要反序列化的PB数据
 // tag: 要反序列化的字段的tag
 // opts: 用户干预反序列化的选择
 // result: 反序列化的结果
-func readBytes(data []byte, tag uint64, opts Options,
+func readBytes(st *decodeState, data []byte, tag uint64, opts Options,
 	result JSONResult) (err error) {
 	defer func() {
 		if err != nil {
@@ -198,50 +526,186 @@ func readBytes(data []byte, tag uint64, opts Options,
 
 	// 根据用户选择进行类型转换，默认进行推测
 	sTag := strconv.FormatUint(tag, 10)
-	typ := opts.GetTypeByTag(sTag)
-	typeName := fmt.Sprintf(typeNamesFormat[typ], tag)
+	if strip, _ := opts.getFieldOption(sTag)[fieldStripInnerLengthKey].(bool); strip {
+		data = stripInnerLength(st, data, tag)
+	}
+	if framing, ok := opts.getFieldOption(sTag)[fieldFramingKey].(map[string]interface{}); ok {
+		data = stripInnerFraming(st, data, tag, framing)
+	}
+	if decoder := opts.customDecoder(sTag); decoder != nil {
+		return readCustom(decoder, data, tag, result)
+	}
+	typ := st.typeOf(opts, sTag)
+	typeName := fieldKey(typ, tag)
 	switch {
 	case typ == Bytes:
-		result.Append(typeName, hex.EncodeToString(data))
+		bytesType, value := st.bytesValue(data)
+		if err = st.countOutput(len(value)); err != nil {
+			return err
+		}
+		result.Append(fieldKey(bytesType, tag), value)
+	case typ == Base64:
+		value := TruncateBase64(data, st.maxStringLen)
+		if err = st.countOutput(len(value)); err != nil {
+			return err
+		}
+		result.Append(typeName, value)
 	case typ == String:
-		result.Append(typeName, string(data))
+		value := TruncateString(data, st.maxStringLen)
+		if err = st.countOutput(len(value)); err != nil {
+			return err
+		}
+		result.Append(typeName, value)
 	case typ == Message:
 		// 递归解析
-		res, nerr := decode(data, opts.GetOptionsByTag(sTag))
+		res, nerr := decode(st, data, opts.GetOptionsByTag(sTag))
 		if nerr != nil {
 			return nerr
 		}
 		result.Append(typeName, res)
-	case typ >= Packed:
+	case typ == Map:
+		return readMapEntry(st, data, tag, opts, result)
+	case typ == Any:
+		return readAny(st, data, tag, opts.GetOptionsByTag(sTag), result)
+	case wktDecoders[typ] != nil:
+		// well-known type，不符合结构时按普通message解析
+		if value, ok := wktDecoders[typ](data); ok {
+			result.Append(typeName, value)
+			return nil
+		}
+		res, nerr := decode(st, data, opts.GetOptionsByTag(sTag))
+		if nerr != nil {
+			return nerr
+		}
+		result.Append(fieldKey(Message, tag), res)
+	case typ == Printable:
+		value := escapePrintable(data)
+		if err = st.countOutput(len(value)); err != nil {
+			return err
+		}
+		result.Append(typeName, value)
+	case isPacked(typ):
 		// packed=true的repeated类型数据
-		return readPacked(data, tag, typ, result)
+		if counted, _ := opts.getFieldOption(sTag)[fieldCountPrefixedKey].(bool); counted {
+			if data, err = stripCount(data, typ); err != nil {
+				return err
+			}
+		}
+		if err = st.countOutput(len(data) * packedOutputFactor); err != nil {
+			return err
+		}
+		return readPacked(data, tag, typ, st.numberFormat(opts, sTag), st.packedEnum(opts, sTag), result)
 	default:
-		// 先推测为嵌套类型
-		res, nerr := decode(data, opts)
-		if nerr == nil {
-			typeName := fmt.Sprintf(typeNamesFormat[Message], tag)
-			result.Append(typeName, res)
+		// 先推测为嵌套类型，超过长度阈值的数据直接按字符串或bytes处理
+		// 空数据可以是任意类型，按照empty_as选择的类型输出
+		switch {
+		case len(data) > 0 || st.emptyAs == Message:
+		case st.emptyAs == Bytes:
+			bytesType, value := st.bytesValue(data)
+			st.guess(tag, data, bytesType, Message, String)
+			result.Append(fieldKey(bytesType, tag), value)
 			return nil
+		default:
+			st.guess(tag, data, String, Message, Bytes)
+			result.Append(fieldKey(String, tag), "")
+			return nil
+		}
+		// 严格模式下不推测，直接输出为bytes
+		if !st.strict && st.shouldSpeculate(data) {
+			mark := st.outputMark()
+			guesses := st.diag.guessMark()
+			res, nerr := decode(st.speculative(), data, opts.inherited())
+			if nerr == nil {
+				// 同时是合法字符串的数据很可能被误判为嵌套类型
+				if len(data) == 0 {
+					st.guess(tag, data, Message, String, Bytes)
+				} else if isString(data) {
+					st.guess(tag, data, Message, String)
+				} else {
+					st.guess(tag, data, Message)
+				}
+				typeName := fieldKey(Message, tag)
+				result.Append(typeName, res)
+				return nil
+			}
+			if errors.Is(nerr, ErrBudgetExceeded) || errors.Is(nerr, ErrTooDeep) || st.cancelled() {
+				return nerr
+			}
+			st.resetOutput(mark)
+			st.diag.resetGuesses(guesses)
 		}
 		// 在判断是否有控制字符，有控制字符，则认为是bytes
-		if !isString(data) {
-			typeName := fmt.Sprintf(typeNamesFormat[Bytes], tag)
-			result.Append(typeName, hex.EncodeToString(data))
+		if st.strict || !isString(data) {
+			bytesType, value := st.bytesValue(data)
+			if err = st.countOutput(len(value)); err != nil {
+				return err
+			}
+			if !st.strict {
+				st.guess(tag, data, bytesType)
+			}
+			typeName := fieldKey(bytesType, tag)
+			result.Append(typeName, value)
 			return nil
 		}
 		// 字符串类型，直接赋值
-		typeName := fmt.Sprintf(typeNamesFormat[String], tag)
-		result.Append(typeName, string(data))
+		value := TruncateString(data, st.maxStringLen)
+		if err = st.countOutput(len(value)); err != nil {
+			return err
+		}
+		st.guess(tag, data, String)
+		typeName := fieldKey(String, tag)
+		result.Append(typeName, value)
 	}
 	return nil
 }
 
+// stripInnerLength 去掉bytes字段数据开头多余的varint长度，用于兼容重复写入长度的编码器
+// 长度与剩余数据不一致时记录警告
+func stripInnerLength(st *decodeState, data []byte, tag uint64) []byte {
+	length, n := protowire.ConsumeVarint(data)
+	if n < 0 {
+		st.warn(tag, data, "strip_inner_length: no inner length")
+		return data
+	}
+	if length != uint64(len(data)-n) {
+		st.warn(tag, data, "strip_inner_length: inner length %d, remaining %d", length, len(data)-n)
+	}
+	return data[n:]
+}
+
+// stripCount 去掉数据开头的元素个数，元素个数与剩余数据中的元素数量不一致时返回错误
+func stripCount(data []byte, typ Type) ([]byte, error) {
+	count, n := protowire.ConsumeVarint(data)
+	if n < 0 {
+		return nil, protowire.ParseError(n)
+	}
+	data = data[n:]
+	var elems int
+	switch wireType(typ - Packed) {
+	case protowire.Fixed32Type:
+		elems = len(data) / 4
+	case protowire.Fixed64Type:
+		elems = len(data) / 8
+	default:
+		for _, b := range data {
+			if b < 0x80 {
+				elems++
+			}
+		}
+	}
+	if count != uint64(elems) {
+		return nil, fmt.Errorf("%w: count %d, %d elements in %d bytes", errCountMismatch, count, elems, len(data))
+	}
+	return data, nil
+}
+
 // readPacked 解析packed类型
 // raw: 要反序列化的PB数据
 // tag: 要反序列化的字段的tag
 // typ: 用户干预反序列化的选择
 // result: 反序列化的结果
-func readPacked(data []byte, tag uint64, typ Type,
+// enum: packed.int32s和packed.int64s配置了__enum时的枚举值转换，为nil时输出数值
+func readPacked(data []byte, tag uint64, typ Type, nf numberFormat, enum func(int32) interface{},
 	result JSONResult) (err error) {
 	defer func() {
 		if err != nil {
@@ -252,27 +716,27 @@ func readPacked(data []byte, tag uint64, typ Type,
 	// 根据类型进行解析
 	switch typ {
 	case Packed + Int32:
-		err = readInt32Packed(data, tag, result)
+		err = readInt32Packed(data, tag, enum, result)
 	case Packed + Int64:
-		err = readInt64Packed(data, tag, result)
+		err = readInt64Packed(data, tag, nf, enum, result)
 	case Packed + UInt:
-		err = readUIntPacked(data, tag, result)
+		err = readUIntPacked(data, tag, nf, result)
 	case Packed + SInt:
-		err = readSIntPacked(data, tag, result)
+		err = readSIntPacked(data, tag, nf, result)
 	case Packed + Bool:
 		err = readBoolPacked(data, tag, result)
 	case Packed + Fixed32:
 		err = readFixed32Packed(data, tag, result)
 	case Packed + Float:
-		err = readFloatPacked(data, tag, result)
+		err = readFloatPacked(data, tag, nf, result)
 	case Packed + SFixed32:
 		err = readSFixed32Packed(data, tag, result)
 	case Packed + Fixed64:
-		err = readFixed64Packed(data, tag, result)
+		err = readFixed64Packed(data, tag, nf, result)
 	case Packed + Double:
-		err = readDoublePacked(data, tag, result)
+		err = readDoublePacked(data, tag, nf, result)
 	case Packed + SFixed64:
-		err = readSFixed64Packed(data, tag, result)
+		err = readSFixed64Packed(data, tag, nf, result)
 	default:
 		return errUnknownType
 	}
@@ -280,7 +744,7 @@ func readPacked(data []byte, tag uint64, typ Type,
 }
 
 // readSFixed64Packed 解析Packed SFixed64类型
-func readSFixed64Packed(data []byte, tag uint64,
+func readSFixed64Packed(data []byte, tag uint64, nf numberFormat,
 	result JSONResult) (err error) {
 	defer func() {
 		if err != nil {
@@ -288,7 +752,7 @@ func readSFixed64Packed(data []byte, tag uint64,
 		}
 	}()
 
-	typeName := fmt.Sprintf(typeNamesFormat[Packed+SFixed64], tag)
+	typeName := fieldKey(Packed+SFixed64, tag)
 	for len(data) > 0 {
 		value, length := protowire.ConsumeFixed64(data)
 		if length < 0 {
@@ -296,13 +760,13 @@ func readSFixed64Packed(data []byte, tag uint64,
 		}
 		data = data[length:]
 		// 采用字符串，防止溢出
-		result.Append(typeName, strconv.FormatInt(int64(value), 10))
+		result.Append(typeName, nf.int64(int64(value), true))
 	}
 	return nil
 }
 
 // readDoublePacked 解析Packed Double类型
-func readDoublePacked(data []byte, tag uint64,
+func readDoublePacked(data []byte, tag uint64, nf numberFormat,
 	result JSONResult) (err error) {
 	defer func() {
 		if err != nil {
@@ -310,20 +774,20 @@ func readDoublePacked(data []byte, tag uint64,
 		}
 	}()
 
-	typeName := fmt.Sprintf(typeNamesFormat[Packed+Double], tag)
+	typeName := fieldKey(Packed+Double, tag)
 	for len(data) > 0 {
 		value, length := protowire.ConsumeFixed64(data)
 		if length < 0 {
 			return protowire.ParseError(length)
 		}
 		data = data[length:]
-		result.Append(typeName, math.Float64frombits(value))
+		result.Append(typeName, nf.float(math.Float64frombits(value), 64))
 	}
 	return nil
 }
 
 // readFixed64Packed 解析Packed Fixed64类型
-func readFixed64Packed(data []byte, tag uint64,
+func readFixed64Packed(data []byte, tag uint64, nf numberFormat,
 	result JSONResult) (err error) {
 	defer func() {
 		if err != nil {
@@ -331,7 +795,7 @@ func readFixed64Packed(data []byte, tag uint64,
 		}
 	}()
 
-	typeName := fmt.Sprintf(typeNamesFormat[Packed+Fixed64], tag)
+	typeName := fieldKey(Packed+Fixed64, tag)
 	for len(data) > 0 {
 		value, length := protowire.ConsumeFixed64(data)
 		if length < 0 {
@@ -339,7 +803,7 @@ func readFixed64Packed(data []byte, tag uint64,
 		}
 		data = data[length:]
 		// 采用字符串，防止溢出
-		result.Append(typeName, strconv.FormatUint(value, 10))
+		result.Append(typeName, nf.uint64(value, true))
 	}
 	return nil
 }
@@ -353,7 +817,7 @@ func readSFixed32Packed(data []byte, tag uint64,
 		}
 	}()
 
-	typeName := fmt.Sprintf(typeNamesFormat[Packed+SFixed32], tag)
+	typeName := fieldKey(Packed+SFixed32, tag)
 	for len(data) > 0 {
 		value, length := protowire.ConsumeFixed32(data)
 		if length < 0 {
@@ -366,7 +830,7 @@ func readSFixed32Packed(data []byte, tag uint64,
 }
 
 // readFloatPacked 解析Packed Float类型
-func readFloatPacked(data []byte, tag uint64,
+func readFloatPacked(data []byte, tag uint64, nf numberFormat,
 	result JSONResult) (err error) {
 	defer func() {
 		if err != nil {
@@ -374,14 +838,14 @@ func readFloatPacked(data []byte, tag uint64,
 		}
 	}()
 
-	typeName := fmt.Sprintf(typeNamesFormat[Packed+Float], tag)
+	typeName := fieldKey(Packed+Float, tag)
 	for len(data) > 0 {
 		value, length := protowire.ConsumeFixed32(data)
 		if length < 0 {
 			return protowire.ParseError(length)
 		}
 		data = data[length:]
-		result.Append(typeName, math.Float32frombits(value))
+		result.Append(typeName, nf.float(float64(math.Float32frombits(value)), 32))
 	}
 	return nil
 }
@@ -395,7 +859,7 @@ func readFixed32Packed(data []byte, tag uint64,
 		}
 	}()
 
-	typeName := fmt.Sprintf(typeNamesFormat[Packed+Fixed32], tag)
+	typeName := fieldKey(Packed+Fixed32, tag)
 	for len(data) > 0 {
 		value, length := protowire.ConsumeFixed32(data)
 		if length < 0 {
@@ -416,7 +880,7 @@ func readBoolPacked(data []byte, tag uint64,
 		}
 	}()
 
-	typeName := fmt.Sprintf(typeNamesFormat[Packed+Bool], tag)
+	typeName := fieldKey(Packed+Bool, tag)
 	for len(data) > 0 {
 		value, length := protowire.ConsumeVarint(data)
 		if length < 0 {
@@ -434,7 +898,7 @@ func readBoolPacked(data []byte, tag uint64,
 }
 
 // readSIntPacked 解析Packed SInt类型
-func readSIntPacked(data []byte, tag uint64,
+func readSIntPacked(data []byte, tag uint64, nf numberFormat,
 	result JSONResult) (err error) {
 	defer func() {
 		if err != nil {
@@ -442,20 +906,20 @@ func readSIntPacked(data []byte, tag uint64,
 		}
 	}()
 
-	typeName := fmt.Sprintf(typeNamesFormat[Packed+SInt], tag)
+	typeName := fieldKey(Packed+SInt, tag)
 	for len(data) > 0 {
 		value, length := protowire.ConsumeVarint(data)
 		if length < 0 {
 			return protowire.ParseError(length)
 		}
 		data = data[length:]
-		result.AppendArrayItem(typeName, protowire.DecodeZigZag(value))
+		result.AppendArrayItem(typeName, nf.int64(protowire.DecodeZigZag(value), false))
 	}
 	return nil
 }
 
 // readUIntPacked 解析Packed UInt类型
-func readUIntPacked(data []byte, tag uint64,
+func readUIntPacked(data []byte, tag uint64, nf numberFormat,
 	result JSONResult) (err error) {
 	defer func() {
 		if err != nil {
@@ -463,20 +927,20 @@ func readUIntPacked(data []byte, tag uint64,
 		}
 	}()
 
-	typeName := fmt.Sprintf(typeNamesFormat[Packed+UInt], tag)
+	typeName := fieldKey(Packed+UInt, tag)
 	for len(data) > 0 {
 		value, length := protowire.ConsumeVarint(data)
 		if length < 0 {
 			return protowire.ParseError(length)
 		}
 		data = data[length:]
-		result.AppendArrayItem(typeName, uint64(value))
+		result.AppendArrayItem(typeName, nf.uint64(value, false))
 	}
 	return nil
 }
 
 // readInt64Packed 解析Packed Int64类型
-func readInt64Packed(data []byte, tag uint64,
+func readInt64Packed(data []byte, tag uint64, nf numberFormat, enum func(int32) interface{},
 	result JSONResult) (err error) {
 	defer func() {
 		if err != nil {
@@ -484,20 +948,24 @@ func readInt64Packed(data []byte, tag uint64,
 		}
 	}()
 
-	typeName := fmt.Sprintf(typeNamesFormat[Packed+Int64], tag)
+	typeName := fieldKey(Packed+Int64, tag)
 	for len(data) > 0 {
 		value, length := protowire.ConsumeVarint(data)
 		if length < 0 {
 			return protowire.ParseError(length)
 		}
 		data = data[length:]
-		result.AppendArrayItem(typeName, int64(value))
+		if enum != nil && int64(value) == int64(int32(value)) {
+			result.AppendArrayItem(typeName, enum(int32(value)))
+			continue
+		}
+		result.AppendArrayItem(typeName, nf.int64(int64(value), false))
 	}
 	return nil
 }
 
 // readInt32Packed 解析Packed Int32类型
-func readInt32Packed(data []byte, tag uint64,
+func readInt32Packed(data []byte, tag uint64, enum func(int32) interface{},
 	result JSONResult) (err error) {
 	defer func() {
 		if err != nil {
@@ -505,14 +973,20 @@ func readInt32Packed(data []byte, tag uint64,
 		}
 	}()
 
-	typeName := fmt.Sprintf(typeNamesFormat[Packed+Int32], tag)
+	typeName := fieldKey(Packed+Int32, tag)
 	for len(data) > 0 {
 		value, length := protowire.ConsumeVarint(data)
 		if length < 0 {
 			return protowire.ParseError(length)
 		}
 		data = data[length:]
-		result.AppendArrayItem(typeName, int32(value))
+		// 负数按照int64符号扩展编码，取低32位
+		v := int32(value)
+		if enum != nil {
+			result.AppendArrayItem(typeName, enum(v))
+			continue
+		}
+		result.AppendArrayItem(typeName, v)
 	}
 	return nil
 }
@@ -522,8 +996,9 @@ func readInt32Packed(data []byte, tag uint64,
 // tag: 要反序列化的字段的tag
 // opts: 用户干预反序列化的选择
 // result: 反序列化的结果
-func readFixed32(raw []byte, tag uint64, opts Options,
+func readFixed32(st *decodeState, raw []byte, tag uint64, opts Options,
 	result JSONResult) ([]byte, error) {
+	field := raw
 	value, length := protowire.ConsumeFixed32(raw)
 	if length < 0 {
 		return raw, protowire.ParseError(length)
@@ -531,25 +1006,40 @@ func readFixed32(raw []byte, tag uint64, opts Options,
 	raw = raw[length:]
 
 	// 根据用户选择进行类型转换，默认Float类型
-	typ := opts.GetTypeByTag(strconv.FormatUint(tag, 10))
-	typeName := fmt.Sprintf(typeNamesFormat[typ], tag)
+	sTag := strconv.FormatUint(tag, 10)
+	typ := st.typeOf(opts, sTag)
+	if isPacked(typ) {
+		// packed的repeated字段也可能以非packed的方式编码，按元素类型解析
+		typ -= Packed
+	}
+	typeName := fieldKey(typ, tag)
+	var v interface{}
 	switch typ {
 	case Float:
-		result.Append(typeName, math.Float32frombits(value))
+		v = st.numberFormat(opts, sTag).float(float64(math.Float32frombits(value)), 32)
 	case SFixed32:
-		result.Append(typeName, int32(value))
+		v = int32(value)
 	case Fixed32:
-		result.Append(typeName, uint32(value))
+		v = uint32(value)
 	default:
-		typeName = fmt.Sprintf(typeNamesFormat[Float], tag)
-		result.Append(typeName, math.Float32frombits(value))
+		typeName = fieldKey(Float, tag)
+		v = st.numberFormat(opts, sTag).float(float64(math.Float32frombits(value)), 32)
+		if reason := implausibleFloat(float64(math.Float32frombits(value)), value&0x7f800000 == 0); reason != "" {
+			st.warn(tag, field, "fixed32 as float is %s, might be an integer: %d", reason, value)
+		}
+	}
+	v, err := transformValue(opts, sTag, v, st.numberFormat(opts, sTag))
+	if err != nil {
+		return raw, err
 	}
+	result.Append(typeName, v)
 	return raw, nil
 }
 
 // readFixed64 解析fix32类型，默认认为是float64
-func readFixed64(raw []byte, tag uint64, opts Options,
+func readFixed64(st *decodeState, raw []byte, tag uint64, opts Options,
 	result JSONResult) ([]byte, error) {
+	field := raw
 	value, length := protowire.ConsumeFixed64(raw)
 	if length < 0 {
 		return raw, protowire.ParseError(length)
@@ -557,24 +1047,142 @@ func readFixed64(raw []byte, tag uint64, opts Options,
 	raw = raw[length:]
 
 	// 根据用户选择进行类型转换，默认Fixed64类型
-	typ := opts.GetTypeByTag(strconv.FormatUint(tag, 10))
-	typeName := fmt.Sprintf(typeNamesFormat[typ], tag)
+	sTag := strconv.FormatUint(tag, 10)
+	typ := st.typeOf(opts, sTag)
+	if isPacked(typ) {
+		// packed的repeated字段也可能以非packed的方式编码，按元素类型解析
+		typ -= Packed
+	}
+	typeName := fieldKey(typ, tag)
+	var v interface{}
 	switch typ {
 	case Double:
-		result.Append(typeName, math.Float64frombits(value))
+		v = st.numberFormat(opts, sTag).float(math.Float64frombits(value), 64)
 	case SFixed64:
 		// 采用字符串，防止溢出
-		result.Append(typeName, strconv.FormatInt(int64(value), 10))
+		v = st.numberFormat(opts, sTag).int64(int64(value), true)
 	case Fixed64:
 		// 采用字符串，防止溢出
-		result.Append(typeName, strconv.FormatUint(value, 10))
+		v = st.numberFormat(opts, sTag).uint64(value, true)
 	default:
-		typeName := fmt.Sprintf(typeNamesFormat[Double], tag)
-		result.Append(typeName, math.Float64frombits(value))
+		typeName = fieldKey(Double, tag)
+		v = st.numberFormat(opts, sTag).float(math.Float64frombits(value), 64)
+		if reason := implausibleFloat(math.Float64frombits(value), value&0x7ff0000000000000 == 0); reason != "" {
+			st.warn(tag, field, "fixed64 as double is %s, might be an integer: %d", reason, value)
+		}
 	}
+	v, err := transformValue(opts, sTag, v, st.numberFormat(opts, sTag))
+	if err != nil {
+		return raw, err
+	}
+	result.Append(typeName, v)
 	return raw, nil
 }
 
+// numberFormat 数值的输出方式
+type numberFormat struct {
+	// precision 浮点数保留的有效数字位数，0表示保持原值
+	precision int
+	// nonFinite NaN和Inf输出的值，为nil时输出为"NaN"、"Infinity"、"-Infinity"
+	nonFinite interface{}
+	// int64AsNumber 64位整数在安全范围内输出为数值，超出范围输出为字符串
+	int64AsNumber bool
+}
+
+// numberFormat 获取字段的数值输出方式，字段选择中的精度优先于全局选择
+func (s *decodeState) numberFormat(opts Options, tag string) numberFormat {
+	nf := numberFormat{precision: s.floatPrecision, nonFinite: s.nonFinite, int64AsNumber: s.int64AsNumber}
+	switch value := opts.getFieldOption(tag)[fieldPrecisionKey].(type) {
+	case float64:
+		nf.precision = int(value)
+	case int:
+		nf.precision = value
+	}
+	return nf
+}
+
+// float 按照输出方式转换浮点数，bitSize为32时输出float32，序列化为json时按照32位的精度输出
+// json不支持NaN和Inf，按照proto3的json映射输出为字符串，避免整个解析失败
+func (nf numberFormat) float(f float64, bitSize int) interface{} {
+	switch {
+	case math.IsNaN(f) || math.IsInf(f, 0):
+		if nf.nonFinite != nil {
+			return nf.nonFinite
+		}
+		return nonFiniteName(f)
+	case nf.precision > 0:
+		f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', nf.precision, bitSize), bitSize)
+	}
+	if bitSize == 32 {
+		return float32(f)
+	}
+	return f
+}
+
+// int64 输出有符号的64位整数，asString为没有选择int64_as_number时是否输出为字符串
+// 选择了int64_as_number时只有超出[-MaxSafeInteger, MaxSafeInteger]的值输出为字符串
+func (nf numberFormat) int64(v int64, asString bool) interface{} {
+	if nf.int64AsNumber {
+		asString = v > MaxSafeInteger || v < -MaxSafeInteger
+	}
+	if asString {
+		return strconv.FormatInt(v, 10)
+	}
+	return v
+}
+
+// uint64 输出无符号的64位整数，规则与int64相同
+func (nf numberFormat) uint64(v uint64, asString bool) interface{} {
+	if nf.int64AsNumber {
+		asString = v > MaxSafeInteger
+	}
+	if asString {
+		return strconv.FormatUint(v, 10)
+	}
+	return v
+}
+
+// nonFiniteName 获取NaN和Inf在proto3的json映射中的名称
+func nonFiniteName(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return "NaN"
+}
+
+const (
+	// maxPlausibleFloat 默认按浮点数解析时，绝对值超出该值的浮点数可能是整数
+	maxPlausibleFloat = 1e15
+	// minPlausibleFloat 默认按浮点数解析时，绝对值小于该值的非零浮点数可能是整数
+	minPlausibleFloat = 1e-15
+)
+
+// implausibleFloat 判断默认按浮点数解析的值是否不像浮点数，返回原因，像浮点数时返回空字符串
+// 整数数据按浮点数解析时通常会得到非规格化数、NaN或者数量级异常的值
+// zeroExponent: 指数位是否全为0，全为0的非零值为非规格化数
+func implausibleFloat(f float64, zeroExponent bool) string {
+	abs := math.Abs(f)
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 0):
+		return "infinite"
+	case f == 0:
+		return ""
+	case zeroExponent:
+		return "denormal"
+	case abs > maxPlausibleFloat || abs < minPlausibleFloat:
+		return fmt.Sprintf("out of plausible range (%g)", f)
+	}
+	return ""
+}
+
+// initialArrayCap 重复的字段变为数组时的初始容量
+const initialArrayCap = 4
+
 // JSONResult Json结果
 type JSONResult map[string]interface{}
 
@@ -586,8 +1194,8 @@ func (j JSONResult) Append(key string, value interface{}) {
 			// 已经有数组值，添加
 			nvalue = append(nvalue, value)
 		} else {
-			// 已经有非数组值，创建数组添加
-			nvalue = []interface{}{temp, value}
+			// 已经有非数组值，创建数组添加，预留空间减少后续添加时的扩容
+			nvalue = append(make([]interface{}, 0, initialArrayCap), temp, value)
 		}
 		j[key] = nvalue
 		return
@@ -603,28 +1211,126 @@ func (j JSONResult) AppendArrayItem(key string, value interface{}) {
 			// 已经有数组值，添加
 			nvalue = append(nvalue, value)
 		} else {
-			// 已经有非数组值，创建数组添加
-			nvalue = []interface{}{temp, value}
+			// 已经有非数组值，创建数组添加，预留空间减少后续添加时的扩容
+			nvalue = append(make([]interface{}, 0, initialArrayCap), temp, value)
 		}
 		j[key] = nvalue
 		return
 	}
 
 	// 还没有值，添加数组值
-	j[key] = []interface{}{value}
+	j[key] = append(make([]interface{}, 0, initialArrayCap), value)
 }
 
 // FixTagTypeNames 修复解析结果中的TagType名称
 func (j JSONResult) FixTagTypeNames() {
+	j.FixTagTypeNamesWithOptions(nil)
+}
+
+// FixTagTypeNamesWithOptions 根据用户选择修复解析结果中的TagType名称
+// 字段选择对象中plural为false时数组的key保持不变，plural_name不为空时数组的key变为 tag_plural_name
+// 全局选择plural_suffix可以修改数组的key的后缀，默认为s，为空时不加后缀
+// 全局选择no_plural为true时所有数组的key都不加后缀
+func (j JSONResult) FixTagTypeNamesWithOptions(opts Options) {
+	suffix := defaultPluralSuffix
+	if value, ok := opts[OptionPluralSuffix].(string); ok {
+		suffix = value
+	}
+	if opts.getBool(OptionNoPlural) {
+		suffix = ""
+	}
+	j.fixTagTypeNames(opts, suffix)
+}
+
+// fixTagTypeNames 修复解析结果中的TagType名称
+// opts: 当前层级的用户选择
+// suffix: 数组的key的后缀
+func (j JSONResult) fixTagTypeNames(opts Options, suffix string) {
 	// 数据类型结果后面加上s，如string数据的类型变为strings
+	// 大部分message没有数组，需要修改key时才分配
+	var renames map[string]string
 	for k, v := range j {
-		// 递归调用
-		if nj, ok := v.(JSONResult); ok {
-			nj.FixTagTypeNames()
+		// 递归调用，扩展字段分组与当前层级使用相同的选择
+		if nj, ok := v.(JSONResult); ok && k == ExtensionsKey {
+			nj.fixTagTypeNames(opts, suffix)
+		} else if ok {
+			nj.fixTagTypeNames(opts.GetOptionsByTag(strconv.FormatUint(keyTag(k), 10)), suffix)
+		} else if m, ok := v.(map[string]interface{}); ok && k == fmt.Sprintf(typeNamesFormat[Map], keyTag(k)) {
+			// map字段中message类型的value使用entry中value的选择
+			valueOpts := opts.GetOptionsByTag(strconv.FormatUint(keyTag(k), 10)).GetOptionsByTag(strconv.Itoa(mapValueTag))
+			for _, mv := range m {
+				if nj, ok := mv.(JSONResult); ok {
+					nj.fixTagTypeNames(valueOpts, suffix)
+				}
+			}
+		} else if ok && opts.isKeyedBy(strconv.FormatUint(keyTag(k), 10)) {
+			// key_by转换后的对象中每个元素使用该字段的选择
+			itemOpts := opts.GetOptionsByTag(strconv.FormatUint(keyTag(k), 10))
+			for _, mv := range m {
+				if nj, ok := mv.(JSONResult); ok {
+					nj.fixTagTypeNames(itemOpts, suffix)
+				}
+			}
+		}
+		if _, ok := v.([]interface{}); ok {
+			if nk := pluralKey(k, opts, suffix); nk != k {
+				if renames == nil {
+					renames = map[string]string{}
+				}
+				renames[k] = nk
+			}
+		}
+	}
+	if len(renames) == 0 {
+		return
+	}
+	// 遍历结束后再修改key，避免遍历时新加入的key被重复处理
+	// 新的key已经存在时合并为一个数组，如同一个字段既有packed又有unpacked的数据
+	// 按照key的顺序合并，保证输出稳定
+	keys := make([]string, 0, len(renames))
+	for k := range renames {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	moved := make(map[string]interface{}, len(renames))
+	for _, k := range keys {
+		nk := renames[k]
+		if v, ok := moved[nk]; ok {
+			moved[nk] = mergeItems(v, j[k])
+		} else {
+			moved[nk] = j[k]
 		}
-		if data, ok := v.([]interface{}); ok {
-			delete(j, k)
-			j[k+"s"] = data
+		delete(j, k)
+	}
+	for nk, v := range moved {
+		if old, ok := j[nk]; ok {
+			v = mergeItems(old, v)
+		}
+		j[nk] = v
+	}
+}
+
+// mergeItems 将两个值合并为一个数组，值本身是数组时展开其中的元素
+func mergeItems(a, b interface{}) []interface{} {
+	items := []interface{}{}
+	for _, v := range []interface{}{a, b} {
+		if vs, ok := v.([]interface{}); ok {
+			items = append(items, vs...)
+		} else {
+			items = append(items, v)
 		}
 	}
+	return items
+}
+
+// pluralKey 获取数组字段的key
+func pluralKey(key string, opts Options, suffix string) string {
+	opt := opts.getFieldOption(strconv.FormatUint(keyTag(key), 10))
+	if plural, ok := opt[fieldPluralKey].(bool); ok && !plural {
+		return key
+	}
+	if name, ok := opt[fieldPluralNameKey].(string); ok && name != "" {
+		return fmt.Sprintf("%d_%s", keyTag(key), name)
+	}
+	return key + suffix
 }
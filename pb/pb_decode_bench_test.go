@@ -0,0 +1,110 @@
+package pb
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// benchPayload 构造一个包含嵌套message、重复字段与packed字段的典型请求
+func benchPayload() ([]byte, Options) {
+	var item []byte
+	item = protowire.AppendTag(item, 1, protowire.VarintType)
+	item = protowire.AppendVarint(item, 10086)
+	item = protowire.AppendTag(item, 2, protowire.BytesType)
+	item = protowire.AppendString(item, "item name")
+	item = protowire.AppendTag(item, 3, protowire.Fixed64Type)
+	item = protowire.AppendFixed64(item, 0x400921fb54442d18)
+
+	var packed []byte
+	for i := uint64(0); i < 16; i++ {
+		packed = protowire.AppendVarint(packed, i*1000)
+	}
+
+	var raw []byte
+	raw = protowire.AppendTag(raw, 1, protowire.VarintType)
+	raw = protowire.AppendVarint(raw, 1234567890)
+	raw = protowire.AppendTag(raw, 2, protowire.BytesType)
+	raw = protowire.AppendString(raw, "hello world")
+	for i := 0; i < 20; i++ {
+		raw = protowire.AppendTag(raw, 3, protowire.BytesType)
+		raw = protowire.AppendBytes(raw, item)
+	}
+	raw = protowire.AppendTag(raw, 4, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, packed)
+	for i := uint64(0); i < 8; i++ {
+		raw = protowire.AppendTag(raw, 5, protowire.VarintType)
+		raw = protowire.AppendVarint(raw, i)
+	}
+
+	opts := Options{
+		"1":        "int64",
+		"2":        "string",
+		"3":        "message",
+		"3options": map[string]interface{}{"1": "int64", "2": "string", "3": "double"},
+		"4":        "packed.int64s",
+		"5":        "int32",
+	}
+	return raw, opts
+}
+
+func BenchmarkDecode(b *testing.B) {
+	raw, opts := benchPayload()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Decode(raw, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecoderDecode(b *testing.B) {
+	raw, opts := benchPayload()
+	dec := NewDecoder(opts)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := dec.Decode(raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// deepPayload 构造嵌套深度超过DefaultMaxDepth的数据
+func deepPayload() []byte {
+	raw := protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1)
+	for i := 0; i < 2*DefaultMaxDepth; i++ {
+		raw = protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), raw)
+	}
+	return raw
+}
+
+func BenchmarkDecodePlanned(b *testing.B) {
+	raw, opts := benchPayload()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodePlanned(raw, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeDeep(b *testing.B) {
+	raw := deepPayload()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Decode(raw, nil); err == nil {
+			b.Fatal("want ErrTooDeep")
+		}
+	}
+}
+
+func BenchmarkDecodePlannedDeep(b *testing.B) {
+	raw := deepPayload()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodePlanned(raw, nil); err == nil {
+			b.Fatal("want ErrTooDeep")
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package pb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestDecodeNegativeInt32(t *testing.T) {
+	// -1按照int64符号扩展编码为10字节的varint
+	minusOne := int64(-1)
+	negative := uint64(minusOne)
+	if n := protowire.SizeVarint(negative); n != 10 {
+		t.Fatalf("varint size %d, want 10", n)
+	}
+	unpacked := protowire.AppendTag(nil, 1, protowire.VarintType)
+	unpacked = protowire.AppendVarint(unpacked, negative)
+	packed := protowire.AppendTag(nil, 1, protowire.BytesType)
+	packed = protowire.AppendBytes(packed, protowire.AppendVarint(protowire.AppendVarint(nil, negative), 2))
+
+	tests := []struct {
+		name string
+		raw  []byte
+		opts Options
+		want string
+	}{
+		{"unpacked", unpacked, Options{"1": "int32"}, `{"1_int32":-1}`},
+		{"packed", packed, Options{"1": "packed.int32s"}, `{"1_packed.int32s":[-1,2]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.raw, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEmpty(t *testing.T) {
+	for _, raw := range [][]byte{nil, {}} {
+		got, err := Decode(raw, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "{}" {
+			t.Errorf("Decode(%#v) got %s, want {}", raw, got)
+		}
+	}
+}
+
+func TestDecodeNonFinite(t *testing.T) {
+	fixed32 := func(bits uint32) []byte {
+		return protowire.AppendFixed32(protowire.AppendTag(nil, 1, protowire.Fixed32Type), bits)
+	}
+	fixed64 := func(bits uint64) []byte {
+		return protowire.AppendFixed64(protowire.AppendTag(nil, 1, protowire.Fixed64Type), bits)
+	}
+	packed := func(data []byte) []byte {
+		return protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), data)
+	}
+	var floats, doubles []byte
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), 1.5} {
+		floats = binary.LittleEndian.AppendUint32(floats, math.Float32bits(float32(f)))
+		doubles = binary.LittleEndian.AppendUint64(doubles, math.Float64bits(f))
+	}
+
+	tests := []struct {
+		name string
+		raw  []byte
+		opts Options
+		want string
+	}{
+		{"float nan", fixed32(0x7fc00000), Options{"1": "float"}, `{"1_float":"NaN"}`},
+		{"float inf", fixed32(0x7f800000), Options{"1": "float"}, `{"1_float":"Infinity"}`},
+		{"float -inf", fixed32(0xff800000), Options{"1": "float"}, `{"1_float":"-Infinity"}`},
+		{"double nan", fixed64(0x7ff8000000000001), Options{"1": "double"}, `{"1_double":"NaN"}`},
+		{"double inf", fixed64(0x7ff0000000000000), Options{"1": "double"}, `{"1_double":"Infinity"}`},
+		{"double -inf", fixed64(0xfff0000000000000), Options{"1": "double"}, `{"1_double":"-Infinity"}`},
+		{"packed floats", packed(floats), Options{"1": "packed.floats"}, `{"1_packed.floats":["NaN","Infinity","-Infinity",1.5]}`},
+		{"packed doubles", packed(doubles), Options{"1": "packed.doubles"}, `{"1_packed.doubles":["NaN","Infinity","-Infinity",1.5]}`},
+		{"non_finite_as", fixed64(0x7ff0000000000000), Options{"1": "double", OptionNonFiniteAs: "-"}, `{"1_double":"-"}`},
+		{"transform", fixed32(0x7fc00000), Options{"1": map[string]interface{}{"type": "float", "transform": "x+1"}}, `{"1_float":"NaN"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.raw, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEmptyAs(t *testing.T) {
+	raw := protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), nil)
+	tests := []struct {
+		emptyAs interface{}
+		want    string
+	}{
+		{nil, `{"1_message":{}}`},
+		{"message", `{"1_message":{}}`},
+		{"string", `{"1_string":""}`},
+		{"bytes", `{"1_bytes":""}`},
+	}
+	for _, tt := range tests {
+		got, err := Decode(raw, Options{OptionEmptyAs: tt.emptyAs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("empty_as %v got %s, want %s", tt.emptyAs, got, tt.want)
+		}
+	}
+}
+
+func TestDecodePluralKeyCollision(t *testing.T) {
+	// 同一个字段既有unpacked又有packed的数据，配置plural_name后两个数组的key相同，需要合并而不是覆盖
+	var raw []byte
+	raw = protowire.AppendVarint(protowire.AppendTag(raw, 1, protowire.VarintType), 1)
+	raw = protowire.AppendBytes(protowire.AppendTag(raw, 1, protowire.BytesType), []byte{3, 4})
+	raw = protowire.AppendVarint(protowire.AppendTag(raw, 1, protowire.VarintType), 2)
+	opts := Options{"1": map[string]interface{}{"type": "packed.int32s", "plural_name": "values"}}
+	got, err := Decode(raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"1_values":[1,2,3,4]}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// 已经存在的key与复数形式的key相同时同样合并
+	j := JSONResult{"1_int32": []interface{}{1, 2}, "1_int32s": 3}
+	j.fixTagTypeNames(nil, defaultPluralSuffix)
+	if want := (JSONResult{"1_int32s": []interface{}{3, 1, 2}}); !reflect.DeepEqual(j, want) {
+		t.Errorf("got %v, want %v", j, want)
+	}
+}
+
+func TestDecodeTooDeep(t *testing.T) {
+	raw := protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1)
+	for i := 0; i < 200; i++ {
+		raw = protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), raw)
+	}
+	for _, opts := range []Options{nil, {"1": "message", "1options": map[string]interface{}{"1": "message"}}} {
+		if _, err := Decode(raw, opts); !errors.Is(err, ErrTooDeep) {
+			t.Errorf("got %v, want %v", err, ErrTooDeep)
+		}
+	}
+}
+
+func TestDecodeLargeTag(t *testing.T) {
+	field := protowire.AppendVarint(protowire.AppendTag(nil, 100000, protowire.VarintType), 1)
+	nested := protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), field)
+	tests := []struct {
+		name string
+		raw  []byte
+		opts Options
+		want string
+	}{
+		{"top level", field, nil, `{"100000_varint":1}`},
+		// 推测嵌套类型时tag不超过MaxTagValue，没有指定类型时不会解析为message
+		{"speculated", nested, nil, `{"1_bytes":"80ea3001"}`},
+		{"typed message", nested, Options{"1": "message"}, `{"1_message":{"100000_varint":1}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.raw, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeAllNumbersAsStrings(t *testing.T) {
+	var sub []byte
+	sub = protowire.AppendFixed32(protowire.AppendTag(sub, 1, protowire.Fixed32Type), math.Float32bits(1.5))
+	sub = protowire.AppendVarint(protowire.AppendTag(sub, 2, protowire.VarintType), 1)
+	var raw []byte
+	raw = protowire.AppendVarint(protowire.AppendTag(raw, 1, protowire.VarintType), 1<<60)
+	raw = protowire.AppendVarint(protowire.AppendTag(raw, 2, protowire.VarintType), protowire.EncodeZigZag(-3))
+	raw = protowire.AppendFixed64(protowire.AppendTag(raw, 3, protowire.Fixed64Type), math.Float64bits(0.1))
+	raw = protowire.AppendFixed32(protowire.AppendTag(raw, 4, protowire.Fixed32Type), 7)
+	raw = protowire.AppendBytes(protowire.AppendTag(raw, 5, protowire.BytesType), []byte{1, 2, 3})
+	raw = protowire.AppendBytes(protowire.AppendTag(raw, 6, protowire.BytesType), sub)
+	raw = protowire.AppendVarint(protowire.AppendTag(raw, 7, protowire.VarintType), 0)
+	raw = protowire.AppendVarint(protowire.AppendTag(raw, 7, protowire.VarintType), 9)
+	opts := Options{
+		"2":                       "sint",
+		"3":                       "double",
+		"4":                       "fixed32",
+		"5":                       "packed.int32s",
+		"6":                       "message",
+		"6options":                map[string]interface{}{"1": "float", "2": "bool"},
+		OptionAllNumbersAsStrings: true,
+	}
+	js, err := Decode(raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bools int
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case json.Number:
+			t.Errorf("bare number %s in %s", v, js)
+		case bool:
+			bools++
+		case map[string]interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	dec := json.NewDecoder(strings.NewReader(js))
+	dec.UseNumber()
+	var result interface{}
+	if err := dec.Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	walk(result)
+	if bools != 1 {
+		t.Errorf("got %d bools in %s, want 1", bools, js)
+	}
+}
+
+func TestIsString(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+		want bool
+	}{
+		{"ascii", []byte("hello world"), true},
+		{"chinese", []byte("你好，世界"), true},
+		{"tab newline cr", []byte("a\tb\nc\r"), true},
+		{"control char", []byte("a\x01b"), false},
+		{"delete char", []byte("a\x7fb"), false},
+		{"invalid utf-8", []byte{0xe4, 0xbd, 'a'}, false},
+		{"truncated utf-8", []byte("你好")[:5], false},
+		{"high bytes", []byte{0xc0, 0xaf, 0xfe, 0xff}, false},
+	}
+	for _, tt := range tests {
+		if got := isString(tt.raw); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// 不是合法UTF-8的数据输出为bytes
+	raw := protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), []byte{0xe4, 0xbd, 'a'})
+	got, err := Decode(raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"1_bytes":"e4bd61"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestDecodeWithHeader(t *testing.T) {
+	raw := protowire.AppendVarint(protowire.AppendTag([]byte{0xca, 0xfe, 0x01}, 1, protowire.VarintType), 5)
+	header, js, err := DecodeWithHeader(raw, 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(header, []byte{0xca, 0xfe, 0x01}) || js != `{"1_varint":5}` {
+		t.Errorf("got %x %s, want cafe01 {\"1_varint\":5}", header, js)
+	}
+	for _, n := range []int{-1, len(raw) + 1} {
+		if _, _, err := DecodeWithHeader(raw, n, nil); !errors.Is(err, errInvalidHeaderLen) {
+			t.Errorf("header length %d: got %v, want %v", n, err, errInvalidHeaderLen)
+		}
+	}
+}
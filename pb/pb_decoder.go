@@ -0,0 +1,80 @@
+package pb
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Decoder 预先解析Options的解析器，同一份Options多次解析时可以复用，并发安全
+// 创建时为每一层的Options计算好tag到类型的映射，解析时不再重复解析字段选择
+type Decoder struct {
+	opts Options
+	// types 每一层Options的tag到类型的映射，key为Options的指针
+	types map[uintptr]map[string]Type
+}
+
+// NewDecoder 根据用户选择创建解析器，创建后不应再修改opts
+func NewDecoder(opts Options) *Decoder {
+	d := &Decoder{opts: opts, types: map[uintptr]map[string]Type{}}
+	d.compile(opts)
+	return d
+}
+
+// Decode 与Decode(raw, opts)相同，使用预先计算的类型映射
+func (d *Decoder) Decode(raw []byte) (string, error) {
+	st := newDecodeState(raw, d.opts)
+	st.types = d.types
+	res, err := decode(st, raw, d.opts)
+	if err != nil {
+		return "", err
+	}
+	return marshalResult(st, res, d.opts)
+}
+
+// compile 计算一层Options中所有tag的类型，并递归处理嵌套的Options
+func (d *Decoder) compile(opts Options) {
+	if opts == nil {
+		return
+	}
+	ptr := reflect.ValueOf(opts).Pointer()
+	if _, ok := d.types[ptr]; ok {
+		return
+	}
+	table := map[string]Type{}
+	d.types[ptr] = table
+	for key := range opts {
+		tag := strings.TrimSuffix(key, "options")
+		if !isTagKey(tag) {
+			continue
+		}
+		table[tag] = opts.GetTypeByTag(tag)
+		d.compile(opts.GetOptionsByTag(tag))
+	}
+}
+
+// isTagKey 判断key是否为十进制的tag
+func isTagKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// typeOf 获取tag对应的类型，opts预先计算过时直接查表
+// 预先计算的映射包含了该层所有配置的tag，查不到即为Unkown
+func (s *decodeState) typeOf(opts Options, tag string) Type {
+	if s.types != nil && opts != nil {
+		if table, ok := s.types[reflect.ValueOf(opts).Pointer()]; ok {
+			if typ, ok := table[tag]; ok {
+				return typ
+			}
+			return Unkown
+		}
+	}
+	return opts.GetTypeByTag(tag)
+}
@@ -0,0 +1,177 @@
+package pb
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var (
+	// kindTypes 字段类型对应的解析类型
+	kindTypes = map[protoreflect.Kind]Type{
+		protoreflect.BoolKind:     Bool,
+		protoreflect.Int32Kind:    Int32,
+		protoreflect.Sint32Kind:   SInt,
+		protoreflect.Uint32Kind:   UInt,
+		protoreflect.Int64Kind:    Int64,
+		protoreflect.Sint64Kind:   SInt,
+		protoreflect.Uint64Kind:   UInt,
+		protoreflect.Sfixed32Kind: SFixed32,
+		protoreflect.Fixed32Kind:  Fixed32,
+		protoreflect.FloatKind:    Float,
+		protoreflect.Sfixed64Kind: SFixed64,
+		protoreflect.Fixed64Kind:  Fixed64,
+		protoreflect.DoubleKind:   Double,
+		protoreflect.StringKind:   String,
+		protoreflect.BytesKind:    Bytes,
+		protoreflect.MessageKind:  Message,
+		protoreflect.GroupKind:    Group,
+	}
+
+	// wktTypes 支持的well-known type
+	wktTypes = map[protoreflect.FullName]Type{
+		"google.protobuf.FieldMask": FieldMask,
+		"google.protobuf.Timestamp": Timestamp,
+		"google.protobuf.Duration":  Duration,
+	}
+)
+
+// DecodeWithDescriptor 根据message的描述将PB二进制数据反序列化为json数据，key为字段的名称
+// 字段的类型由描述决定，枚举输出为名称，repeated字段总是输出为数组
+// 描述中没有的字段按照默认的方式推测类型，key保持 tag_type 格式
+// raw: 要进行反序列化的PB数据
+// md: 数据对应的message的描述
+func DecodeWithDescriptor(raw []byte, md protoreflect.MessageDescriptor) (string, error) {
+	opts := Options(descriptorOptions(md, map[protoreflect.FullName]map[string]interface{}{}))
+	res, err := decode(newDecodeState(raw, opts), raw, opts)
+	if err != nil {
+		return "", err
+	}
+	res.FixTagTypeNamesWithOptions(opts)
+	data, err := json.Marshal(renameFields(res, md))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// descriptorOptions 根据message的描述生成每个字段的选择
+// seen: 已经生成的message的选择，递归定义的message引用同一个选择
+func descriptorOptions(md protoreflect.MessageDescriptor,
+	seen map[protoreflect.FullName]map[string]interface{}) map[string]interface{} {
+	if opts, ok := seen[md.FullName()]; ok {
+		return opts
+	}
+	opts := map[string]interface{}{}
+	seen[md.FullName()] = opts
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		opts[strconv.Itoa(int(fd.Number()))] = descriptorFieldOption(fd, seen)
+	}
+	return opts
+}
+
+// descriptorFieldOption 根据字段的描述生成字段选择对象
+func descriptorFieldOption(fd protoreflect.FieldDescriptor,
+	seen map[protoreflect.FullName]map[string]interface{}) map[string]interface{} {
+	if fd.IsMap() {
+		return map[string]interface{}{
+			fieldTypeKey:    TypeName(Map),
+			fieldOptionsKey: descriptorOptions(fd.Message(), seen),
+		}
+	}
+	if fd.Kind() == protoreflect.EnumKind {
+		names := map[string]interface{}{}
+		values := fd.Enum().Values()
+		for i := 0; i < values.Len(); i++ {
+			names[strconv.Itoa(int(values.Get(i).Number()))] = string(values.Get(i).Name())
+		}
+		// repeated的枚举与数值类型一样使用packed类型，packed和非packed编码的元素都输出为名称
+		if fd.IsList() {
+			return map[string]interface{}{fieldTypeKey: TypeName(Packed+Int32) + "s", fieldEnumKey: names}
+		}
+		return map[string]interface{}{fieldEnumKey: names}
+	}
+	typ := kindTypes[fd.Kind()]
+	if md := fd.Message(); md != nil {
+		if wkt, ok := wktTypes[md.FullName()]; ok && typ == Message {
+			typ = wkt
+		}
+		return map[string]interface{}{
+			fieldTypeKey:    TypeName(typ),
+			fieldOptionsKey: descriptorOptions(md, seen),
+		}
+	}
+	// repeated的数值类型使用packed类型，非packed编码的数据同样可以解析
+	if fd.IsList() && typ != String && typ != Bytes {
+		return map[string]interface{}{fieldTypeKey: TypeName(Packed+typ) + "s"}
+	}
+	return map[string]interface{}{fieldTypeKey: TypeName(typ)}
+}
+
+// renameFields 将解析结果中描述里有的字段的key修改为字段的名称
+// repeated字段的值总是数组，非repeated字段出现多次时以最后一个值为准
+// 同一字段的packed和非packed数据按照key的顺序合并，保证输出稳定
+func renameFields(res JSONResult, md protoreflect.MessageDescriptor) JSONResult {
+	keys := make([]string, 0, len(res))
+	for k := range res {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make(JSONResult, len(res))
+	for _, k := range keys {
+		v := res[k]
+		fd := md.Fields().ByNumber(protowire.Number(keyTag(k)))
+		if fd == nil {
+			out[k] = v
+			continue
+		}
+		v = renameValue(v, fd)
+		name := string(fd.Name())
+		items, isArray := v.([]interface{})
+		if !fd.IsList() {
+			if isArray && len(items) > 0 {
+				v = items[len(items)-1]
+			}
+			out[name] = v
+			continue
+		}
+		if !isArray {
+			items = []interface{}{v}
+		}
+		// packed和非packed编码的数据分别在不同的key中
+		if prev, ok := out[name].([]interface{}); ok {
+			items = append(prev, items...)
+		}
+		out[name] = items
+	}
+	return out
+}
+
+// renameValue 修改字段的值中嵌套message的key
+func renameValue(v interface{}, fd protoreflect.FieldDescriptor) interface{} {
+	switch value := v.(type) {
+	case JSONResult:
+		if fd.Message() != nil {
+			return renameFields(value, fd.Message())
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = renameValue(item, fd)
+		}
+	case map[string]interface{}:
+		if !fd.IsMap() || fd.MapValue().Message() == nil {
+			break
+		}
+		for k, item := range value {
+			if nj, ok := item.(JSONResult); ok {
+				value[k] = renameFields(nj, fd.MapValue().Message())
+			}
+		}
+	}
+	return v
+}
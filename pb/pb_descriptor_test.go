@@ -0,0 +1,96 @@
+package pb
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// testDescriptor 构造测试用的message描述
+//
+//	enum Status { UNKNOWN = 0; ACTIVE = 1; }
+//	message Inner { int32 id = 1; Status status = 2; }
+//	message Outer { string name = 1; repeated Status statuses = 2; Inner inner = 3; repeated int32 nums = 4; }
+func testDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label,
+		typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  label.Enum(),
+			Type:   typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("ACTIVE"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Inner"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+					field("status", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.Status"),
+				},
+			},
+			{
+				Name: proto.String("Outer"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("statuses", 2, repeated, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.Status"),
+					field("inner", 3, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Inner"),
+					field("nums", 4, repeated, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd.Messages().ByName("Outer")
+}
+
+func TestDecodeWithDescriptor(t *testing.T) {
+	var inner []byte
+	inner = protowire.AppendVarint(protowire.AppendTag(inner, 1, protowire.VarintType), 7)
+	inner = protowire.AppendVarint(protowire.AppendTag(inner, 2, protowire.VarintType), 1)
+
+	var raw []byte
+	raw = protowire.AppendString(protowire.AppendTag(raw, 1, protowire.BytesType), "foo")
+	// 非packed编码的枚举元素
+	raw = protowire.AppendVarint(protowire.AppendTag(raw, 2, protowire.VarintType), 1)
+	// proto3的repeated枚举默认packed编码，5不在枚举中
+	raw = protowire.AppendBytes(protowire.AppendTag(raw, 2, protowire.BytesType), []byte{1, 0, 5})
+	raw = protowire.AppendBytes(protowire.AppendTag(raw, 3, protowire.BytesType), inner)
+	raw = protowire.AppendBytes(protowire.AppendTag(raw, 4, protowire.BytesType), []byte{1, 2})
+	// 描述中没有的字段
+	raw = protowire.AppendVarint(protowire.AppendTag(raw, 9, protowire.VarintType), 3)
+
+	got, err := DecodeWithDescriptor(raw, testDescriptor(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"9_varint":3,"inner":{"id":7,"status":"ACTIVE"},"name":"foo","nums":[1,2],"statuses":["ACTIVE","ACTIVE","UNKNOWN",5]}`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package pb
+
+const (
+	// GuessAmbiguous 数据可以同时作为多种类型解析，推测的类型很可能是错误的
+	GuessAmbiguous = 0.5
+	// GuessLikely 数据只能作为推测的类型解析，或者推测为其它类型失败
+	GuessLikely = 0.9
+)
+
+// Diagnostics 解析过程中收集的诊断信息
+type Diagnostics struct {
+	// Skipped 被跳过的数据区间，仅在开启skip_unknown_wire时出现，说明结果是有损的
+	Skipped []SkippedRegion `json:"skipped,omitempty"`
+	// Warnings 不影响解析结果的警告
+	Warnings []Warning `json:"warnings,omitempty"`
+	// Guesses 没有指定类型的bytes字段推测的类型，仅在开启report_guesses时出现
+	Guesses []Guess `json:"guesses,omitempty"`
+}
+
+// Guess 没有指定类型的bytes字段推测的类型
+type Guess struct {
+	// Tag 字段的tag
+	Tag uint64 `json:"tag"`
+	// Offset 字段数据在原始数据中的偏移
+	Offset int `json:"offset"`
+	// Type 推测的类型，如 message、string、bytes
+	Type string `json:"type"`
+	// Confidence 推测的可信度，GuessAmbiguous或者GuessLikely
+	Confidence float64 `json:"confidence"`
+	// Alternatives 数据同样可以解析为的其它类型
+	Alternatives []string `json:"alternatives,omitempty"`
+}
+
+// Warning 解析过程中的警告
+type Warning struct {
+	// Tag 字段的tag
+	Tag uint64 `json:"tag"`
+	// Offset 字段数据在原始数据中的偏移
+	Offset int `json:"offset"`
+	// Message 警告的内容
+	Message string `json:"message"`
+}
+
+// SkippedRegion 被跳过的数据区间
+type SkippedRegion struct {
+	// Offset 区间在原始数据中的偏移
+	Offset int `json:"offset"`
+	// Length 区间的长度
+	Length int `json:"length"`
+	// Reason 跳过的原因
+	Reason string `json:"reason"`
+}
+
+// addSkipped 记录被跳过的数据区间
+func (d *Diagnostics) addSkipped(offset, length int, reason string) {
+	if d == nil {
+		return
+	}
+	d.Skipped = append(d.Skipped, SkippedRegion{
+		Offset: offset,
+		Length: length,
+		Reason: reason,
+	})
+}
+
+// addWarning 记录警告
+func (d *Diagnostics) addWarning(tag uint64, offset int, message string) {
+	if d == nil {
+		return
+	}
+	d.Warnings = append(d.Warnings, Warning{
+		Tag:     tag,
+		Offset:  offset,
+		Message: message,
+	})
+}
+
+// addGuess 记录推测的类型
+func (d *Diagnostics) addGuess(guess Guess) {
+	if d == nil {
+		return
+	}
+	d.Guesses = append(d.Guesses, guess)
+}
+
+// guessMark 记录当前推测的数量，推测为嵌套类型失败时用于回滚嵌套字段的推测
+func (d *Diagnostics) guessMark() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.Guesses)
+}
+
+// resetGuesses 回滚推测的类型
+func (d *Diagnostics) resetGuesses(mark int) {
+	if d != nil {
+		d.Guesses = d.Guesses[:mark]
+	}
+}
+
+// DecodeWithDiagnostics 将PB二进制数据反序列化为json数据，并返回解析过程中的诊断信息
+// 全局选择report_guesses为true时同时返回没有指定类型的bytes字段推测的类型及其可信度
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+func DecodeWithDiagnostics(raw []byte, opts Options) (string, *Diagnostics, error) {
+	diag := &Diagnostics{}
+	st := newDecodeState(raw, opts)
+	st.diag = diag
+	res, err := decode(st, raw, opts)
+	if err != nil {
+		return "", diag, err
+	}
+	js, err := marshalResult(st, res, opts)
+	return js, diag, err
+}
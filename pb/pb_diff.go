@@ -0,0 +1,106 @@
+package pb
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// ChangeKind 字段变化的类型
+type ChangeKind string
+
+const (
+	// ChangeAdded 字段只在b中出现
+	ChangeAdded ChangeKind = "added"
+	// ChangeRemoved 字段只在a中出现
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeModified 字段的值不同
+	ChangeModified ChangeKind = "changed"
+)
+
+// Change 一个字段的变化
+type Change struct {
+	// Path 字段的tag路径，与DecodeWithPaths的路径格式一致，如 1.3[0].5
+	Path string `json:"path"`
+	// Kind 变化的类型
+	Kind ChangeKind `json:"kind"`
+	// Old a中的值
+	Old interface{} `json:"old,omitempty"`
+	// New b中的值
+	New interface{} `json:"new,omitempty"`
+}
+
+// Diff 使用相同的选择解析两份PB数据，返回字段级别的差异，按路径中的tag排序
+// a: 变化前的PB数据
+// b: 变化后的PB数据
+// opts: 用户针对每个字段的干预选择
+func Diff(a, b []byte, opts Options) ([]Change, error) {
+	pathsA, err := DecodeWithPaths(a, opts)
+	if err != nil {
+		return nil, fmt.Errorf("a: %w", err)
+	}
+	pathsB, err := DecodeWithPaths(b, opts)
+	if err != nil {
+		return nil, fmt.Errorf("b: %w", err)
+	}
+	return DiffPaths(pathsA, pathsB), nil
+}
+
+// DiffPaths 比较两个DecodeWithPaths的结果，返回字段级别的差异，按路径中的tag排序
+func DiffPaths(a, b map[string]interface{}) []Change {
+	changes := []Change{}
+	for path, old := range a {
+		value, ok := b[path]
+		if !ok {
+			changes = append(changes, Change{Path: path, Kind: ChangeRemoved, Old: old})
+			continue
+		}
+		if !reflect.DeepEqual(old, value) {
+			changes = append(changes, Change{Path: path, Kind: ChangeModified, Old: old, New: value})
+		}
+	}
+	for path, value := range b {
+		if _, ok := a[path]; !ok {
+			changes = append(changes, Change{Path: path, Kind: ChangeAdded, New: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return lessPath(changes[i].Path, changes[j].Path)
+	})
+	return changes
+}
+
+// lessPath 按照路径中的数字依次比较，数字相同时按字符串比较
+func lessPath(a, b string) bool {
+	na, nb := pathNumbers(a), pathNumbers(b)
+	for i := 0; i < len(na) && i < len(nb); i++ {
+		if na[i] != nb[i] {
+			return na[i] < nb[i]
+		}
+	}
+	if len(na) != len(nb) {
+		return len(na) < len(nb)
+	}
+	return a < b
+}
+
+// pathNumbers 获取路径中所有的数字，包括tag和下标
+func pathNumbers(path string) []uint64 {
+	var numbers []uint64
+	start := -1
+	for i := 0; i <= len(path); i++ {
+		if i < len(path) && path[i] >= '0' && path[i] <= '9' {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			n, _ := strconv.ParseUint(path[start:i], 10, 64)
+			numbers = append(numbers, n)
+			start = -1
+		}
+	}
+	return numbers
+}
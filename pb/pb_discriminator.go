@@ -0,0 +1,56 @@
+package pb
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// pendingField 等待判别字段解析完成后再解析的bytes字段
+type pendingField struct {
+	tag  uint64
+	data []byte
+}
+
+// discriminatorOf 获取bytes字段对应的判别字段的tag
+// 如 {"2": {"type": "message", "discriminator": "1", "cases": {"3": {...}, "4": {...}}}}
+// 表示tag为2的字段根据tag为1的字段的值选择cases中的选择进行解析
+func (o Options) discriminatorOf(tag uint64) (string, bool) {
+	disc, ok := o.getFieldOption(strconv.FormatUint(tag, 10))[fieldDiscriminatorKey].(string)
+	return disc, ok
+}
+
+// readDiscriminated 在当前message的其它字段解析完成后，根据判别字段的值解析bytes字段
+// 判别字段不存在或者值没有对应的选择时按照默认的推测方式解析
+func readDiscriminated(st *decodeState, pending []pendingField, opts Options, result JSONResult) error {
+	for _, f := range pending {
+		sTag := strconv.FormatUint(f.tag, 10)
+		disc, _ := opts.discriminatorOf(f.tag)
+		cases, _ := opts.getFieldOption(sTag)[fieldCasesKey].(map[string]interface{})
+		caseOpts, ok := cases[discriminatorValue(result, disc)].(map[string]interface{})
+		if !ok {
+			if err := readBytes(st, f.data, f.tag, nil, result); err != nil {
+				return wrapFieldError(f.tag, st.offset(f.data), err)
+			}
+			continue
+		}
+		res, err := decode(st, f.data, Options(caseOpts))
+		if err != nil {
+			return wrapFieldError(f.tag, st.offset(f.data), err)
+		}
+		result.Append(fieldKey(Message, f.tag), res)
+	}
+	return nil
+}
+
+// discriminatorValue 获取判别字段的值，repeated字段使用第一个值，不存在时返回空字符串
+func discriminatorValue(result JSONResult, disc string) string {
+	key, ok := findTagKey(result, disc)
+	if !ok {
+		return ""
+	}
+	value := result[key]
+	if items, ok := value.([]interface{}); ok && len(items) > 0 {
+		value = items[0]
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,123 @@
+package pb
+
+import (
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// wireTypeNames wire type的名称
+var wireTypeNames = map[Type]string{
+	Varint:  "varint",
+	Fixed64: "fixed64",
+	Bytes:   "bytes",
+	Fixed32: "fixed32",
+}
+
+// Node 类似Wireshark协议树的字段节点
+type Node struct {
+	// Offset 字段(包括tag)在原始数据中的偏移，嵌套message中的字段同样相对于原始数据
+	Offset int `json:"offset"`
+	// Length 字段(包括tag)的字节数
+	Length int `json:"length"`
+	// WireType 字段的wire type，根节点为空
+	WireType string `json:"wire_type,omitempty"`
+	// Tag 字段的tag，根节点为0
+	Tag uint64 `json:"tag,omitempty"`
+	// Type 解析的类型，与Decode输出的key中的类型名称一致
+	Type string `json:"type"`
+	// Value 解析的值，message没有值
+	Value interface{} `json:"value,omitempty"`
+	// Children message中的字段
+	Children []*Node `json:"children,omitempty"`
+}
+
+// DecodeDissection 将PB二进制数据解析为类似Wireshark协议树的节点树，每个节点带有字节偏移和长度
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+func DecodeDissection(raw []byte, opts Options) (*Node, error) {
+	st := newDecodeState(raw, opts)
+	children, err := dissect(st, raw, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Node{
+		Offset:   0,
+		Length:   len(raw),
+		Type:     TypeName(Message),
+		Children: children,
+	}, nil
+}
+
+// dissect 解析message中的所有字段节点，值的解析与decode一致
+func dissect(st *decodeState, raw []byte, opts Options) ([]*Node, error) {
+	if err := st.enter(); err != nil {
+		return nil, err
+	}
+	defer st.leave()
+	nodes := []*Node{}
+	for len(raw) > 0 {
+		start := raw
+		tagType, rest, err := readTagType(raw, st.maxTag)
+		if err != nil {
+			return nil, err
+		}
+		node := &Node{
+			Offset:   st.offset(start),
+			Tag:      tagType.Tag,
+			WireType: wireTypeNames[tagType.Type],
+		}
+
+		value := JSONResult{}
+		switch tagType.Type {
+		case Varint:
+			rest, err = readVarint(st, rest, tagType.Tag, opts, value)
+		case Fixed32:
+			rest, err = readFixed32(st, rest, tagType.Tag, opts, value)
+		case Fixed64:
+			rest, err = readFixed64(st, rest, tagType.Tag, opts, value)
+		case Bytes:
+			data, length := protowire.ConsumeBytes(rest)
+			if length < 0 {
+				return nil, protowire.ParseError(length)
+			}
+			rest = rest[length:]
+			node.Children, err = dissectBytes(st, data, tagType.Tag, opts, value)
+		default:
+			return nil, errUnknownType
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if node.Children != nil {
+			node.Type = TypeName(Message)
+		}
+		for k, v := range value {
+			node.Type = k[strings.IndexByte(k, '_')+1:]
+			node.Value = v
+		}
+		node.Length = len(start) - len(rest)
+		nodes = append(nodes, node)
+		raw = rest
+	}
+	return nodes, nil
+}
+
+// dissectBytes 解析bytes字段，嵌套类型返回子节点，其它类型的值写入value
+func dissectBytes(st *decodeState, data []byte, tag uint64, opts Options, value JSONResult) ([]*Node, error) {
+	sTag := strconv.FormatUint(tag, 10)
+	switch opts.GetTypeByTag(sTag) {
+	case Message:
+		return dissect(st, data, opts.GetOptionsByTag(sTag))
+	case Unkown:
+		// 与decode一样先推测为嵌套类型
+		if len(data) > 0 && st.shouldSpeculate(data) {
+			if children, err := dissect(st.speculative(), data, opts.inherited()); err == nil {
+				return children, nil
+			}
+		}
+	}
+	return nil, readBytes(st, data, tag, opts, value)
+}
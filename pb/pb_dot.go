@@ -0,0 +1,117 @@
+package pb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxDOTArrayItems DOT图中数组最多展示的元素个数，超出部分汇总为一个节点
+	maxDOTArrayItems = 10
+	// maxDOTValueLen DOT图中节点值最多展示的字符数
+	maxDOTValueLen = 32
+)
+
+// DecodeDOT 将PB二进制数据反序列化后输出为Graphviz DOT格式的树
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+func DecodeDOT(raw []byte, opts Options) (string, error) {
+	res, err := decode(newDecodeState(raw, opts), raw, opts)
+	if err != nil {
+		return "", err
+	}
+	res.FixTagTypeNamesWithOptions(opts)
+
+	w := &dotWriter{}
+	w.buf.WriteString("digraph pb {\n")
+	w.buf.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	root := w.addNode("message")
+	w.writeResult(root, res)
+	w.buf.WriteString("}\n")
+	return w.buf.String(), nil
+}
+
+// dotWriter 输出DOT图的辅助结构
+type dotWriter struct {
+	buf strings.Builder
+	// seq 节点编号
+	seq int
+}
+
+// addNode 添加一个节点，返回节点名称
+func (w *dotWriter) addNode(label string) string {
+	name := fmt.Sprintf("n%d", w.seq)
+	w.seq++
+	fmt.Fprintf(&w.buf, "\t%s [label=\"%s\"];\n", name, escapeDOT(label))
+	return name
+}
+
+// addEdge 添加一条边
+func (w *dotWriter) addEdge(from, to string) {
+	fmt.Fprintf(&w.buf, "\t%s -> %s;\n", from, to)
+}
+
+// writeResult 输出message的所有字段，按key排序保证输出稳定
+func (w *dotWriter) writeResult(parent string, res JSONResult) {
+	keys := make([]string, 0, len(res))
+	for k := range res {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		w.writeValue(parent, k, res[k])
+	}
+}
+
+// writeValue 输出一个字段，key为 tag_type 格式
+func (w *dotWriter) writeValue(parent, key string, value interface{}) {
+	switch v := value.(type) {
+	case JSONResult:
+		node := w.addNode(key)
+		w.addEdge(parent, node)
+		w.writeResult(node, v)
+	case []interface{}:
+		node := w.addNode(fmt.Sprintf("%s [%d]", key, len(v)))
+		w.addEdge(parent, node)
+		for i, item := range v {
+			if i >= maxDOTArrayItems {
+				more := w.addNode(fmt.Sprintf("... (+%d more)", len(v)-i))
+				w.addEdge(node, more)
+				break
+			}
+			w.writeValue(node, fmt.Sprintf("[%d]", i), item)
+		}
+	default:
+		node := w.addNode(fmt.Sprintf("%s = %s", key, truncateDOT(fmt.Sprint(v))))
+		w.addEdge(parent, node)
+	}
+}
+
+// truncateDOT 截断过长的值，避免图中节点过大
+func truncateDOT(s string) string {
+	r := []rune(s)
+	if len(r) <= maxDOTValueLen {
+		return s
+	}
+	return string(r[:maxDOTValueLen]) + "..."
+}
+
+// escapeDOT 转义DOT标签中的特殊字符
+func escapeDOT(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case '\n':
+			b.WriteString("\\n")
+		case '\r', '\t':
+			b.WriteByte(' ')
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,586 @@
+package pb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	// errInvalidKey 字段的key不是 tag_type 格式
+	errInvalidKey = errors.New("invalid field key")
+	// errInvalidValue 字段的值与类型不匹配
+	errInvalidValue = errors.New("invalid field value")
+)
+
+// Encode 将Decode输出的json数据序列化为PB二进制数据
+// jsonStr: key为 tag_type 格式的json数据，repeated字段的key可以带s或者plural_suffix指定的后缀
+func Encode(jsonStr string) ([]byte, error) {
+	return EncodeWithOptions(jsonStr, nil)
+}
+
+// EncodeWithOptions 与Encode相同，使用解析时的用户选择确定json中没有记录的类型，如map的key和value的类型
+// jsonStr: key为 tag_type 格式的json数据
+// opts: 解析时使用的用户选择
+func EncodeWithOptions(jsonStr string, opts Options) ([]byte, error) {
+	dec := json.NewDecoder(strings.NewReader(jsonStr))
+	// 使用json.Number避免大整数精度丢失
+	dec.UseNumber()
+	msg, err := decodeOrderedJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, nil
+	}
+	if _, ok := msg.(*OrderedResult); !ok {
+		return nil, fmt.Errorf("%w: message must be a json object", errInvalidValue)
+	}
+	return encodeMessage(newEncodeState(opts), nil, msg, opts)
+}
+
+// decodeOrderedJSON 读取一个json值，对象读取为OrderedResult以保持字段在json中的顺序
+func decodeOrderedJSON(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+	switch delim {
+	case '{':
+		obj := NewOrderedResult()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(key.(string), value)
+		}
+		if _, err = dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case '[':
+		items := []interface{}{}
+		for dec.More() {
+			item, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		if _, err = dec.Token(); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("%w: unexpected %v", errInvalidValue, delim)
+}
+
+// asMessage 获取json对象的字段，OrderedResult同时返回字段的顺序，其它类型的顺序为nil
+func asMessage(value interface{}) (map[string]interface{}, []string, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, nil, true
+	case JSONResult:
+		return v, nil, true
+	case *OrderedResult:
+		return v.values, v.keys, true
+	}
+	return nil, nil, false
+}
+
+// asMap 获取json对象的字段，不关心字段的顺序
+func asMap(value interface{}) (map[string]interface{}, bool) {
+	m, _, ok := asMessage(value)
+	return m, ok
+}
+
+// EncodeInterface 将DecodeInterface输出的数据序列化为PB二进制数据
+// 与Encode相同，值可以是解析得到的Go类型，如int32、float32、JSONResult
+func EncodeInterface(msg map[string]interface{}) ([]byte, error) {
+	return encodeMessage(newEncodeState(nil), nil, msg, nil)
+}
+
+// encodeState 序列化过程中只在最外层配置的用户选择
+type encodeState struct {
+	// bytesBase64 bytes_encoding为base64，Any中的bytes数据使用base64还原
+	bytesBase64 bool
+}
+
+// newEncodeState 从最外层的用户选择创建序列化状态
+func newEncodeState(opts Options) *encodeState {
+	return &encodeState{bytesBase64: opts[OptionBytesEncoding] == BytesEncodingBase64}
+}
+
+// encodedField 待序列化的字段
+type encodedField struct {
+	key   string
+	tag   protowire.Number
+	typ   Type
+	value interface{}
+	// opts 字段的嵌套选择
+	opts Options
+	// fieldOpt 字段选择对象，如枚举的__enum映射
+	fieldOpt map[string]interface{}
+}
+
+// newEncodedField 创建待序列化的字段，opts为当前层级的用户选择
+func newEncodedField(key string, tag protowire.Number, typ Type, value interface{}, opts Options) encodedField {
+	sTag := strconv.Itoa(int(tag))
+	return encodedField{key: key, tag: tag, typ: typ, value: value,
+		opts: opts.GetOptionsByTag(sTag), fieldOpt: opts.getFieldOption(sTag)}
+}
+
+// encodeMessage 序列化一个message，OrderedResult按照字段在json中的顺序输出，其它类型的字段按照tag排序
+// opts: 当前层级的用户选择，可以为nil
+func encodeMessage(st *encodeState, buf []byte, msg interface{}, opts Options) ([]byte, error) {
+	values, keys, ok := asMessage(msg)
+	if !ok {
+		return nil, errInvalidValue
+	}
+	ordered := keys != nil
+	if !ordered {
+		keys = make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+	}
+	fields := make([]encodedField, 0, len(keys))
+	for _, k := range keys {
+		v := values[k]
+		// 扩展字段分组中的字段与其它字段一起序列化，位置为分组所在的位置
+		if k == ExtensionsKey {
+			if ext, extKeys, ok := asMessage(v); ok {
+				if extKeys == nil {
+					for ek := range ext {
+						extKeys = append(extKeys, ek)
+					}
+				}
+				for _, ek := range extKeys {
+					tag, typ, err := parseFieldKey(ek)
+					if err != nil {
+						return nil, err
+					}
+					fields = append(fields, newEncodedField(ek, tag, typ, ext[ek], opts))
+				}
+				continue
+			}
+		}
+		tag, typ, err := parseFieldKey(k)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, newEncodedField(k, tag, typ, v, opts))
+	}
+	if !ordered {
+		sort.Slice(fields, func(i, j int) bool {
+			if fields[i].tag != fields[j].tag {
+				return fields[i].tag < fields[j].tag
+			}
+			return fields[i].key < fields[j].key
+		})
+	}
+
+	var err error
+	for _, f := range fields {
+		buf, err = encodeField(st, buf, f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.key, err)
+		}
+	}
+	return buf, nil
+}
+
+// parseFieldKey 从 tag_type 格式的key中解析tag和类型，兼容带s后缀的repeated字段
+func parseFieldKey(key string) (protowire.Number, Type, error) {
+	idx := strings.IndexByte(key, '_')
+	if idx <= 0 {
+		return 0, Unkown, fmt.Errorf("%w: %s", errInvalidKey, key)
+	}
+	tag, err := strconv.ParseUint(key[:idx], 10, 32)
+	if err != nil || tag == 0 || tag > uint64(protowire.MaxValidNumber) {
+		return 0, Unkown, fmt.Errorf("%w: %s", errInvalidKey, key)
+	}
+	name := key[idx+1:]
+	if typ, ok := namesToType[name]; ok {
+		return protowire.Number(tag), typ, nil
+	}
+	// 只有一个元素的packed类型没有s后缀
+	if typ, ok := namesToType[name+"s"]; ok {
+		return protowire.Number(tag), typ, nil
+	}
+	// 通过plural_suffix修改了后缀时，使用最长的类型名称前缀
+	for i := len(name) - 1; i > 0; i-- {
+		if typ, ok := namesToType[name[:i]]; ok {
+			return protowire.Number(tag), typ, nil
+		}
+		if typ, ok := namesToType[name[:i]+"s"]; ok {
+			return protowire.Number(tag), typ, nil
+		}
+	}
+	return 0, Unkown, fmt.Errorf("%w: %s", errInvalidKey, key)
+}
+
+// encodeField 序列化一个字段，数组的每个元素作为一个字段序列化，packed类型序列化为一个字段
+func encodeField(st *encodeState, buf []byte, f encodedField) ([]byte, error) {
+	if isPacked(f.typ) {
+		items, ok := f.value.([]interface{})
+		if !ok {
+			items = []interface{}{f.value}
+		}
+		var packed []byte
+		var err error
+		for _, item := range items {
+			if f.fieldOpt[fieldEnumKey] != nil {
+				if item, err = enumNumber(item, f.fieldOpt); err != nil {
+					return nil, err
+				}
+			}
+			packed, err = appendScalar(packed, f.typ-Packed, item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		buf = protowire.AppendTag(buf, f.tag, protowire.BytesType)
+		return protowire.AppendBytes(buf, packed), nil
+	}
+
+	if f.typ == Map {
+		return encodeMap(st, buf, f)
+	}
+
+	items, ok := f.value.([]interface{})
+	if !ok {
+		items = []interface{}{f.value}
+	}
+	var err error
+	if f.typ == Group {
+		for _, item := range items {
+			buf = protowire.AppendTag(buf, f.tag, protowire.StartGroupType)
+			if buf, err = appendGroup(st, buf, item, f.opts); err != nil {
+				return nil, err
+			}
+			buf = protowire.AppendTag(buf, f.tag, protowire.EndGroupType)
+		}
+		return buf, nil
+	}
+	for _, item := range items {
+		if f.typ == Enum {
+			if item, err = enumNumber(item, f.fieldOpt); err != nil {
+				return nil, err
+			}
+		}
+		buf = protowire.AppendTag(buf, f.tag, wireType(f.typ))
+		buf, err = appendValue(st, buf, f.typ, item, f.opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// appendGroup 序列化group中的字段，不包括StartGroup和EndGroup
+func appendGroup(st *encodeState, buf []byte, value interface{}, opts Options) ([]byte, error) {
+	return encodeMessage(st, buf, value, opts)
+}
+
+// wireType 获取类型对应的wire type
+func wireType(typ Type) protowire.Type {
+	switch typ {
+	case Varint, Int32, Int64, UInt, SInt, Bool, Flags, Enum, TimestampS, TimestampMs:
+		return protowire.VarintType
+	case Fixed32, Float, SFixed32:
+		return protowire.Fixed32Type
+	case Fixed64, Double, SFixed64:
+		return protowire.Fixed64Type
+	}
+	return protowire.BytesType
+}
+
+// appendValue 序列化一个值，不包括tag
+// opts: 字段的嵌套选择
+func appendValue(st *encodeState, buf []byte, typ Type, value interface{}, opts Options) ([]byte, error) {
+	switch typ {
+	case Bytes:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errInvalidValue
+		}
+		data, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidValue, err)
+		}
+		return protowire.AppendBytes(buf, data), nil
+	case Base64:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errInvalidValue
+		}
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidValue, err)
+		}
+		return protowire.AppendBytes(buf, data), nil
+	case String:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errInvalidValue
+		}
+		return protowire.AppendString(buf, s), nil
+	case Printable:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errInvalidValue
+		}
+		data, err := unescapePrintable(s)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendBytes(buf, data), nil
+	case Message:
+		data, err := encodeMessage(st, nil, value, opts)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendBytes(buf, data), nil
+	case Any:
+		data, err := encodeAny(st, value, opts)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendBytes(buf, data), nil
+	case Timestamp, Duration, FieldMask:
+		encode := encodeTimestampWKT
+		switch typ {
+		case Duration:
+			encode = encodeDuration
+		case FieldMask:
+			encode = encodeFieldMask
+		}
+		data, err := encode(value)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendBytes(buf, data), nil
+	case Flags:
+		// flags类型使用原始值
+		flags, ok := asMap(value)
+		if !ok {
+			return nil, errInvalidValue
+		}
+		return appendScalar(buf, Varint, flags["value"])
+	case TimestampS, TimestampMs:
+		// 时间戳类型使用原始值
+		ts, ok := asMap(value)
+		if !ok {
+			return nil, errInvalidValue
+		}
+		return appendScalar(buf, Int64, ts["value"])
+	case Varint:
+		// varint_interpretations输出的各种解释使用其中的无符号值
+		if interpretations, ok := asMap(value); ok {
+			value = interpretations["as_uint"]
+		}
+		return appendScalar(buf, Varint, value)
+	case Enum:
+		// 名称在encodeField中通过__enum映射还原，同时输出名称和数值时使用其中的数值
+		if both, ok := asMap(value); ok {
+			value = both["number"]
+		}
+		return appendScalar(buf, Int32, value)
+	}
+	return appendScalar(buf, typ, value)
+}
+
+// appendScalar 序列化数值类型的值
+func appendScalar(buf []byte, typ Type, value interface{}) ([]byte, error) {
+	switch typ {
+	case Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, errInvalidValue
+		}
+		return protowire.AppendVarint(buf, protowire.EncodeBool(b)), nil
+	case Varint, UInt:
+		v, err := toUint64(value)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendVarint(buf, v), nil
+	case Int32, Int64:
+		// 负数按照64位补码序列化，与protobuf一致
+		v, err := toInt64(value)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendVarint(buf, uint64(v)), nil
+	case SInt:
+		v, err := toInt64(value)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendVarint(buf, protowire.EncodeZigZag(v)), nil
+	case Float:
+		v, err := toFloat64(value)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendFixed32(buf, math.Float32bits(float32(v))), nil
+	case Fixed32:
+		v, err := toUint64(value)
+		if err != nil || v > math.MaxUint32 {
+			return nil, errInvalidValue
+		}
+		return protowire.AppendFixed32(buf, uint32(v)), nil
+	case SFixed32:
+		v, err := toInt64(value)
+		if err != nil || v < math.MinInt32 || v > math.MaxInt32 {
+			return nil, errInvalidValue
+		}
+		return protowire.AppendFixed32(buf, uint32(int32(v))), nil
+	case Double:
+		v, err := toFloat64(value)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendFixed64(buf, math.Float64bits(v)), nil
+	case Fixed64:
+		v, err := toUint64(value)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendFixed64(buf, v), nil
+	case SFixed64:
+		v, err := toInt64(value)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendFixed64(buf, uint64(v)), nil
+	}
+	name := TypeName(typ)
+	if name == "" {
+		name = strconv.Itoa(int(typ))
+	}
+	return nil, fmt.Errorf("%w: unsupported type %s", errInvalidValue, name)
+}
+
+// numberString 获取数值的字符串形式，64位整数在Decode的输出中可能是字符串
+// 同时支持DecodeInterface输出的Go数值类型
+func numberString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.String(), nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	}
+	return "", errInvalidValue
+}
+
+// toUint64 将值转换为uint64
+func toUint64(value interface{}) (uint64, error) {
+	s, err := numberString(value)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errInvalidValue, err)
+	}
+	return v, nil
+}
+
+// toInt64 将值转换为int64
+func toInt64(value interface{}) (int64, error) {
+	s, err := numberString(value)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errInvalidValue, err)
+	}
+	return v, nil
+}
+
+// toFloat64 将值转换为float64
+func toFloat64(value interface{}) (float64, error) {
+	s, err := numberString(value)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errInvalidValue, err)
+	}
+	return v, nil
+}
+
+// unescapePrintable 还原escapePrintable转义后的数据
+func unescapePrintable(s string) ([]byte, error) {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			buf.WriteByte(c)
+			continue
+		}
+		if i+1 >= len(s) {
+			return nil, fmt.Errorf("%w: bad escape", errInvalidValue)
+		}
+		i++
+		switch s[i] {
+		case '\\', '\'':
+			buf.WriteByte(s[i])
+		case 't':
+			buf.WriteByte(HorizontalTab)
+		case 'n':
+			buf.WriteByte(NewLineChar)
+		case 'r':
+			buf.WriteByte(CarriageReturn)
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, fmt.Errorf("%w: bad escape", errInvalidValue)
+			}
+			b, err := hex.DecodeString(s[i+1 : i+3])
+			if err != nil {
+				return nil, fmt.Errorf("%w: bad escape", errInvalidValue)
+			}
+			buf.Write(b)
+			i += 2
+		default:
+			return nil, fmt.Errorf("%w: bad escape", errInvalidValue)
+		}
+	}
+	return buf.Bytes(), nil
+}
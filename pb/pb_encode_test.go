@@ -0,0 +1,71 @@
+package pb
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestEncodeFieldOrder(t *testing.T) {
+	varint := func(buf []byte, tag protowire.Number, v uint64) []byte {
+		buf = protowire.AppendTag(buf, tag, protowire.VarintType)
+		return protowire.AppendVarint(buf, v)
+	}
+	nested := varint(varint(nil, 2, 20), 1, 10)
+	tests := []struct {
+		name string
+		js   string
+		want []byte
+	}{
+		{
+			name: "json order",
+			js:   `{"3_varint":3,"1_varint":1,"2_varint":2}`,
+			want: varint(varint(varint(nil, 3, 3), 1, 1), 2, 2),
+		},
+		{
+			name: "nested message",
+			js:   `{"2_message":{"2_varint":20,"1_varint":10},"1_varint":1}`,
+			want: varint(protowire.AppendBytes(protowire.AppendTag(nil, 2, protowire.BytesType), nested), 1, 1),
+		},
+		{
+			name: "extensions in place",
+			js:   `{"5_varint":5,"` + ExtensionsKey + `":{"100_varint":100,"4_varint":4},"1_varint":1}`,
+			want: varint(varint(varint(varint(nil, 5, 5), 100, 100), 4, 4), 1, 1),
+		},
+		{
+			name: "any fields",
+			js:   `{"1_any":{"2_varint":20,"@type":"type.googleapis.com/foo.Bar","1_varint":10}}`,
+			want: protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), anyMessage("type.googleapis.com/foo.Bar", nested)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Encode(tt.js)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeInterfaceSortsByTag(t *testing.T) {
+	got, err := EncodeInterface(map[string]interface{}{"2_varint": 2, "1_varint": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1)
+	want = protowire.AppendVarint(protowire.AppendTag(want, 2, protowire.VarintType), 2)
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+}
+
+func TestEncodeNotObject(t *testing.T) {
+	if _, err := Encode(`[1,2]`); err == nil {
+		t.Error("want error for json array")
+	}
+}
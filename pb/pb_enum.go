@@ -0,0 +1,69 @@
+package pb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// enumName 根据字段选择中__enum的映射获取枚举值的名称，没有映射时返回false
+// 如 {"5": {"__enum": {"0": "UNKNOWN", "1": "ACTIVE"}}} 中1的名称为ACTIVE
+func enumName(number int32, opt map[string]interface{}) (string, bool) {
+	names, _ := opt[fieldEnumKey].(map[string]interface{})
+	name, ok := names[strconv.FormatInt(int64(number), 10)].(string)
+	return name, ok
+}
+
+// enumValue 根据字段选择中的映射获取枚举值的展示
+// 有映射时输出名称，没有映射时输出数值
+// both为true或者字段选择中enum_both为true时输出 {"name": "ACTIVE", "number": 1}，没有映射时没有name
+func enumValue(number int32, opt map[string]interface{}, both bool) interface{} {
+	name, ok := enumName(number, opt)
+	if fieldBoth, _ := opt[fieldEnumBothKey].(bool); both || fieldBoth {
+		value := map[string]interface{}{"number": number}
+		if ok {
+			value["name"] = name
+		}
+		return value
+	}
+	if ok {
+		return name
+	}
+	return number
+}
+
+// packedEnum packed.int32s和packed.int64s字段配置了__enum时返回枚举值的转换函数，否则返回nil
+// 如 {"5": {"type": "packed.int32s", "__enum": {"1": "ACTIVE"}}}，数组中的元素输出为名称
+func (s *decodeState) packedEnum(opts Options, tag string) func(int32) interface{} {
+	typ := opts.GetTypeByTag(tag)
+	opt := opts.getFieldOption(tag)
+	if (typ != Packed+Int32 && typ != Packed+Int64) || opt[fieldEnumKey] == nil {
+		return nil
+	}
+	return func(number int32) interface{} {
+		return enumValue(number, opt, s.enumBoth)
+	}
+}
+
+// enumNumber 将Decode输出的枚举值还原为数值，值可以是名称、数值或者 {"name": "ACTIVE", "number": 1}
+// 名称通过字段选择中__enum的映射还原，映射中没有的名称返回错误
+func enumNumber(value interface{}, opt map[string]interface{}) (interface{}, error) {
+	if both, ok := asMap(value); ok {
+		return both["number"], nil
+	}
+	name, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	names, _ := opt[fieldEnumKey].(map[string]interface{})
+	for number, n := range names {
+		if n == name {
+			return json.Number(number), nil
+		}
+	}
+	// all_numbers_as_strings输出的数值
+	if _, err := strconv.ParseInt(name, 10, 64); err == nil {
+		return value, nil
+	}
+	return nil, fmt.Errorf("%w: unknown enum name %q", errInvalidValue, name)
+}
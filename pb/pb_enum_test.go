@@ -0,0 +1,131 @@
+package pb
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// varintFields 构造tag相同的多个varint字段
+func varintFields(tag protowire.Number, values ...uint64) []byte {
+	var raw []byte
+	for _, v := range values {
+		raw = protowire.AppendVarint(protowire.AppendTag(raw, tag, protowire.VarintType), v)
+	}
+	return raw
+}
+
+func TestDecodeEnumNames(t *testing.T) {
+	names := map[string]interface{}{"0": "UNKNOWN", "1": "ACTIVE"}
+	tests := []struct {
+		name string
+		raw  []byte
+		opts Options
+		want string
+	}{
+		{"mapped", varintFields(5, 1), Options{"5": map[string]interface{}{"__enum": names}}, `{"5_enum":"ACTIVE"}`},
+		{"zero", varintFields(5, 0), Options{"5": map[string]interface{}{"__enum": names}}, `{"5_enum":"UNKNOWN"}`},
+		{"unmapped", varintFields(5, 7), Options{"5": map[string]interface{}{"__enum": names}}, `{"5_enum":7}`},
+		{"explicit type", varintFields(5, 1), Options{"5": map[string]interface{}{"type": "enum", "__enum": names}}, `{"5_enum":"ACTIVE"}`},
+		{"repeated", varintFields(5, 1, 7), Options{"5": map[string]interface{}{"__enum": names}}, `{"5_enums":["ACTIVE",7]}`},
+		{"nested", protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), varintFields(5, 0)),
+			Options{"1": "message", "1options": map[string]interface{}{"5": map[string]interface{}{"__enum": names}}},
+			`{"1_message":{"5_enum":"UNKNOWN"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.raw, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeEnum(t *testing.T) {
+	names := map[string]interface{}{"0": "UNKNOWN", "1": "ACTIVE", "2": "BLOCKED"}
+	tests := []struct {
+		name string
+		raw  []byte
+		opts Options
+		want string
+	}{
+		{"name", varintFields(5, 1), Options{"5": map[string]interface{}{"__enum": names}}, `{"5_enum":"ACTIVE"}`},
+		{"repeated mixed", varintFields(5, 2, 7), Options{"5": map[string]interface{}{"__enum": names}}, `{"5_enums":["BLOCKED",7]}`},
+		{"enum_both", varintFields(5, 1), Options{"5": map[string]interface{}{"__enum": names}, OptionEnumBoth: true},
+			`{"5_enum":{"name":"ACTIVE","number":1}}`},
+		{"field enum_both unmapped", varintFields(5, 7), Options{"5": map[string]interface{}{"__enum": names, "enum_both": true}},
+			`{"5_enum":{"number":7}}`},
+		{"packed", protowire.AppendBytes(protowire.AppendTag(nil, 5, protowire.BytesType), []byte{1, 7, 0}),
+			Options{"5": map[string]interface{}{"type": "packed.int32s", "__enum": names}},
+			`{"5_packed.int32s":["ACTIVE",7,"UNKNOWN"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := Decode(tt.raw, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if js != tt.want {
+				t.Fatalf("decode got %s, want %s", js, tt.want)
+			}
+			encoded, err := EncodeWithOptions(js, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(encoded, tt.raw) {
+				t.Errorf("encode got %x, want %x", encoded, tt.raw)
+			}
+			if _, err := DecodeVerify(tt.raw, tt.opts); err != nil {
+				t.Errorf("verify: %v", err)
+			}
+		})
+	}
+
+	if _, err := EncodeWithOptions(`{"5_enum":"MISSING"}`, Options{"5": map[string]interface{}{"__enum": names}}); !errors.Is(err, errInvalidValue) {
+		t.Errorf("unknown name: got %v, want %v", err, errInvalidValue)
+	}
+}
+
+func TestDecodePackedEnum(t *testing.T) {
+	names := map[string]interface{}{"-1": "NEGATIVE", "1": "ACTIVE"}
+	minusOne := int64(-1)
+	var data []byte
+	data = protowire.AppendVarint(data, 1)                // 有映射
+	data = protowire.AppendVarint(data, 7)                // 没有映射
+	data = protowire.AppendVarint(data, uint64(minusOne)) // 负数
+	data = protowire.AppendVarint(data, 1<<40)            // 超出int32范围
+	raw := protowire.AppendBytes(protowire.AppendTag(nil, 5, protowire.BytesType), data)
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		// int32截断为低32位，1<<40的低32位为0
+		{"int32s", Options{"5": map[string]interface{}{"type": "packed.int32s", "__enum": names}},
+			`{"5_packed.int32s":["ACTIVE",7,"NEGATIVE",0]}`},
+		// 超出int32范围的int64不是枚举值，按照数值输出
+		{"int64s", Options{"5": map[string]interface{}{"type": "packed.int64s", "__enum": names}},
+			`{"5_packed.int64s":["ACTIVE",7,"NEGATIVE",1099511627776]}`},
+		{"int64s enum_both", Options{"5": map[string]interface{}{"type": "packed.int64s", "__enum": names, "enum_both": true}},
+			`{"5_packed.int64s":[{"name":"ACTIVE","number":1},{"number":7},{"name":"NEGATIVE","number":-1},1099511627776]}`},
+		{"without mapping", Options{"5": "packed.int64s"}, `{"5_packed.int64s":[1,7,-1,1099511627776]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(raw, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
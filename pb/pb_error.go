@@ -0,0 +1,50 @@
+package pb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DecodeError 解析失败的字段位置，可以通过errors.Is和errors.As获取底层的错误
+type DecodeError struct {
+	// Path 从顶层到解析失败的字段的tag路径，tag本身无法读取时为所在message的路径
+	Path []uint64
+	// Offset 解析失败的字段在原始数据中的偏移，coalesce拼接的字段中为拼接后数据中的偏移
+	Offset int
+	// Err 底层的错误
+	Err error
+}
+
+// PathString 返回点号连接的tag路径，如 5.3.1
+func (e *DecodeError) PathString() string {
+	parts := make([]string, len(e.Path))
+	for i, tag := range e.Path {
+		parts[i] = strconv.FormatUint(tag, 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Error 实现error接口
+func (e *DecodeError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("at offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("field %s at offset %d: %v", e.PathString(), e.Offset, e.Err)
+}
+
+// Unwrap 返回底层的错误
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// wrapFieldError 将字段解析的错误转换为DecodeError
+// 嵌套字段返回的DecodeError在路径前加上当前的tag，保留最内层的偏移和底层的错误
+func wrapFieldError(tag uint64, offset int, err error) error {
+	var de *DecodeError
+	if errors.As(err, &de) {
+		return &DecodeError{Path: append([]uint64{tag}, de.Path...), Offset: de.Offset, Err: de.Err}
+	}
+	return &DecodeError{Path: []uint64{tag}, Offset: offset, Err: err}
+}
@@ -0,0 +1,62 @@
+package pb
+
+// ExtensionsKey 扩展字段在解析结果中的分组key
+const ExtensionsKey = "__extensions"
+
+// extensionRange 扩展字段的tag范围，包括start和end
+type extensionRange struct {
+	start uint64
+	end   uint64
+}
+
+// extensionRanges 获取当前层级的扩展字段范围，格式为 [[100, 199], [1000, 536870911]]
+// 对应proto2中message的 extensions 100 to 199; 声明，即描述文件中DescriptorProto的extension_range
+// 只有单个数值的范围表示只包含这个tag
+func (o Options) extensionRanges() []extensionRange {
+	items, ok := o[OptionExtensionRanges].([]interface{})
+	if !ok {
+		return nil
+	}
+	ranges := make([]extensionRange, 0, len(items))
+	for _, item := range items {
+		bounds, ok := item.([]interface{})
+		if !ok || len(bounds) == 0 || len(bounds) > 2 {
+			continue
+		}
+		start, ok := bounds[0].(float64)
+		if !ok || start < 1 {
+			continue
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, ok = bounds[1].(float64); !ok || end < start {
+				continue
+			}
+		}
+		ranges = append(ranges, extensionRange{start: uint64(start), end: uint64(end)})
+	}
+	return ranges
+}
+
+// groupExtensions 将tag在扩展范围内的字段移动到__extensions分组中，与已知字段区分
+// 扩展字段的类型与其它字段一样通过选择指定或者推测
+func groupExtensions(result JSONResult, opts Options) {
+	ranges := opts.extensionRanges()
+	if len(ranges) == 0 {
+		return
+	}
+	ext := JSONResult{}
+	for k, v := range result {
+		tag := keyTag(k)
+		for _, r := range ranges {
+			if tag >= r.start && tag <= r.end {
+				ext[k] = v
+				delete(result, k)
+				break
+			}
+		}
+	}
+	if len(ext) > 0 {
+		result[ExtensionsKey] = ext
+	}
+}
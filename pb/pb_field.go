@@ -0,0 +1,57 @@
+package pb
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Field 获取解析结果中tag对应字段的值，值的类型为T时返回true
+// 字段的key为 tag_type 格式，不需要关心类型名称，字段是数组(repeated)时返回false，使用RepeatedField获取
+// 如 pb.Field[int32](res, 1) 获取 1_int32 字段的值
+func Field[T any](res JSONResult, tag uint64) (T, bool) {
+	var zero T
+	for _, value := range tagValues(res, tag) {
+		if v, ok := value.(T); ok {
+			return v, true
+		}
+	}
+	return zero, false
+}
+
+// RepeatedField 获取解析结果中tag对应的repeated字段的所有值，所有元素的类型都为T时返回true
+// 只出现一次的字段作为只有一个元素的数组返回
+func RepeatedField[T any](res JSONResult, tag uint64) ([]T, bool) {
+	for _, value := range tagValues(res, tag) {
+		if v, ok := value.(T); ok {
+			return []T{v}, true
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		values := make([]T, 0, len(items))
+		for _, item := range items {
+			v, ok := item.(T)
+			if !ok {
+				break
+			}
+			values = append(values, v)
+		}
+		if len(values) == len(items) {
+			return values, true
+		}
+	}
+	return nil, false
+}
+
+// tagValues 获取解析结果中所有tag为tag的字段的值
+func tagValues(res JSONResult, tag uint64) []interface{} {
+	prefix := strconv.FormatUint(tag, 10) + "_"
+	var values []interface{}
+	for k, v := range res {
+		if strings.HasPrefix(k, prefix) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
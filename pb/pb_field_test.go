@@ -0,0 +1,50 @@
+package pb
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestField(t *testing.T) {
+	var raw []byte
+	raw = protowire.AppendVarint(protowire.AppendTag(raw, 1, protowire.VarintType), 7)
+	raw = protowire.AppendString(protowire.AppendTag(raw, 2, protowire.BytesType), "hello")
+	raw = protowire.AppendVarint(protowire.AppendTag(raw, 3, protowire.VarintType), 1)
+	raw = protowire.AppendVarint(protowire.AppendTag(raw, 3, protowire.VarintType), 2)
+	opts := Options{"1": "int32", "2": "string", "3": "int32"}
+	res, err := decode(newDecodeState(raw, opts), raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := Field[int32](res, 1); !ok || v != 7 {
+		t.Errorf("present: got %v %v, want 7 true", v, ok)
+	}
+	if v, ok := Field[string](res, 2); !ok || v != "hello" {
+		t.Errorf("present: got %q %v, want hello true", v, ok)
+	}
+	if _, ok := Field[int32](res, 4); ok {
+		t.Error("absent: got true, want false")
+	}
+	if _, ok := Field[string](res, 1); ok {
+		t.Error("wrong type: got true, want false")
+	}
+	if _, ok := Field[int32](res, 3); ok {
+		t.Error("repeated: got true, want false")
+	}
+
+	if v, ok := RepeatedField[int32](res, 3); !ok || !reflect.DeepEqual(v, []int32{1, 2}) {
+		t.Errorf("repeated: got %v %v, want [1 2] true", v, ok)
+	}
+	if v, ok := RepeatedField[int32](res, 1); !ok || !reflect.DeepEqual(v, []int32{7}) {
+		t.Errorf("single: got %v %v, want [7] true", v, ok)
+	}
+	if _, ok := RepeatedField[int32](res, 4); ok {
+		t.Error("absent: got true, want false")
+	}
+	if _, ok := RepeatedField[string](res, 3); ok {
+		t.Error("wrong type: got true, want false")
+	}
+}
@@ -0,0 +1,32 @@
+package pb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	// errUnterminatedGroup group没有对应的EndGroup，或者EndGroup的tag不一致
+	errUnterminatedGroup = errors.New("unterminated group")
+	// errUnexpectedEndGroup 出现了没有对应StartGroup的EndGroup
+	errUnexpectedEndGroup = errors.New("unexpected end group")
+)
+
+// readGroup 读取proto2的group，raw为StartGroup之后的数据
+// group中的字段作为嵌套的message解析，使用tag对应的嵌套选择
+func readGroup(st *decodeState, raw []byte, tag uint64, opts Options,
+	result JSONResult) ([]byte, error) {
+	content, length := protowire.ConsumeGroup(protowire.Number(tag), raw)
+	if length < 0 {
+		return raw, fmt.Errorf("%w: tag %d at offset %d: %v", errUnterminatedGroup, tag, st.offset(raw), protowire.ParseError(length))
+	}
+	res, err := decode(st, content, opts.GetOptionsByTag(strconv.FormatUint(tag, 10)))
+	if err != nil {
+		return raw, err
+	}
+	result.Append(fieldKey(Group, tag), res)
+	return raw[length:], nil
+}
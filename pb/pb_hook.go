@@ -0,0 +1,66 @@
+package pb
+
+import (
+	"encoding/json"
+)
+
+// Hook 序列化前对解析结果进行处理的函数，可以修改、脱敏或者校验结果，返回错误时解析失败
+type Hook func(res JSONResult) error
+
+// DecodeWithHook 将PB二进制数据反序列化为json数据，序列化前在修复TagType名称后的结果上执行hook
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+// hook: 处理最外层结果的函数
+func DecodeWithHook(raw []byte, opts Options, hook func(JSONResult) error) (string, error) {
+	return decodeWithHook(raw, opts, hook, false)
+}
+
+// DecodeWithNestedHook 与DecodeWithHook相同，但hook对每一个嵌套的message也会执行
+// 嵌套的message先于包含它的message执行
+func DecodeWithNestedHook(raw []byte, opts Options, hook func(JSONResult) error) (string, error) {
+	return decodeWithHook(raw, opts, hook, true)
+}
+
+// decodeWithHook 解析后执行hook再序列化
+func decodeWithHook(raw []byte, opts Options, hook Hook, nested bool) (string, error) {
+	res, err := decode(newDecodeState(raw, opts), raw, opts)
+	if err != nil {
+		return "", err
+	}
+	res.FixTagTypeNamesWithOptions(opts)
+
+	if nested {
+		err = walkResults(res, hook)
+	} else {
+		err = hook(res)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// walkResults 后序遍历所有嵌套的message并执行hook
+func walkResults(value interface{}, hook Hook) error {
+	switch v := value.(type) {
+	case JSONResult:
+		for _, child := range v {
+			if err := walkResults(child, hook); err != nil {
+				return err
+			}
+		}
+		return hook(v)
+	case []interface{}:
+		for _, item := range v {
+			if err := walkResults(item, hook); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
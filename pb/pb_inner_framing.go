@@ -0,0 +1,44 @@
+package pb
+
+// 内层封装描述中的key
+const (
+	// innerFramingSkipKey 数据开头需要跳过的字节数，如魔数、版本号
+	innerFramingSkipKey = "skip"
+	// innerFramingLengthKey 跳过开头的字节后长度前缀的编码方式，取值与Framing一致，为空表示没有长度前缀
+	innerFramingLengthKey = "length"
+	// innerFramingTrailerKey 数据末尾需要去掉的字节数，如校验和
+	innerFramingTrailerKey = "trailer"
+)
+
+// stripInnerFraming 根据字段选择中的framing描述去掉自定义的封装，返回内层的数据
+// 如 {"5": {"type": "message", "framing": {"skip": 2, "length": "u32be"}}}
+// 数据与描述不符时记录警告并返回原始数据，按照没有封装解析
+func stripInnerFraming(st *decodeState, data []byte, tag uint64, framing map[string]interface{}) []byte {
+	inner := data
+	if trailer := Options(framing).getInt(innerFramingTrailerKey, 0); trailer > 0 {
+		if trailer > len(inner) {
+			st.warn(tag, data, "framing: trailer %d longer than data %d", trailer, len(inner))
+			return data
+		}
+		inner = inner[:len(inner)-trailer]
+	}
+	if skip := Options(framing).getInt(innerFramingSkipKey, 0); skip > 0 {
+		if skip > len(inner) {
+			st.warn(tag, data, "framing: skip %d longer than data %d", skip, len(inner))
+			return data
+		}
+		inner = inner[skip:]
+	}
+	if length, ok := framing[innerFramingLengthKey].(string); ok && length != "" {
+		msg, rest, err := nextFrame(inner, Framing(length))
+		if err != nil {
+			st.warn(tag, data, "framing: %v", err)
+			return data
+		}
+		if len(rest) > 0 {
+			st.warn(tag, data, "framing: %d bytes after inner message", len(rest))
+		}
+		inner = msg
+	}
+	return inner
+}
@@ -0,0 +1,76 @@
+package pb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// applyKeyBy 将配置了key_by的repeated message转换为以子字段的值为key的对象
+// 如 {"5": {"type": "message", "key_by": "1"}} 会将5_message数组转换为
+// {"<元素中tag为1的字段的值>": 元素}，元素缺少该字段、字段不是简单类型或者值重复时保持数组
+func applyKeyBy(result JSONResult, opts Options) {
+	for tag := range opts {
+		keyBy, ok := opts.getFieldOption(tag)[fieldKeyByKey].(string)
+		if !ok {
+			continue
+		}
+		key := tag + "_message"
+		items, ok := result[key].([]interface{})
+		if !ok {
+			// 单个元素也转换为对象
+			if item, ok := result[key].(JSONResult); ok {
+				items = []interface{}{item}
+			}
+		}
+		if keyed, ok := keyItemsBy(items, keyBy); ok {
+			result[key] = keyed
+		}
+	}
+}
+
+// keyItemsBy 以子字段keyBy的值为key转换数组，无法转换时返回false
+// 返回普通的map而不是JSONResult，避免FixTagTypeNames将元素的key当作tag，元素由isKeyedBy单独修复
+func keyItemsBy(items []interface{}, keyBy string) (map[string]interface{}, bool) {
+	if len(items) == 0 {
+		return nil, false
+	}
+	keyed := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		msg, ok := item.(JSONResult)
+		if !ok {
+			return nil, false
+		}
+		fieldKey, ok := findTagKey(msg, keyBy)
+		if !ok {
+			return nil, false
+		}
+		switch msg[fieldKey].(type) {
+		case JSONResult, []interface{}:
+			// 嵌套类型和数组不能作为key
+			return nil, false
+		}
+		id := fmt.Sprint(msg[fieldKey])
+		if _, ok := keyed[id]; ok {
+			return nil, false
+		}
+		keyed[id] = msg
+	}
+	return keyed, true
+}
+
+// isKeyedBy 判断tag是否配置了key_by
+func (o Options) isKeyedBy(tag string) bool {
+	_, ok := o.getFieldOption(tag)[fieldKeyByKey].(string)
+	return ok
+}
+
+// findTagKey 在结果中查找tag对应的key，key的格式为 tag_type
+func findTagKey(res JSONResult, tag string) (string, bool) {
+	prefix := tag + "_"
+	for k := range res {
+		if strings.HasPrefix(k, prefix) {
+			return k, true
+		}
+	}
+	return "", false
+}
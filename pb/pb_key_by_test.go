@@ -0,0 +1,45 @@
+package pb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// keyByItem 构造 {1: id, 2: a, 2: b} 的message
+func keyByItem(id, a, b uint64) []byte {
+	var m []byte
+	m = protowire.AppendTag(m, 1, protowire.VarintType)
+	m = protowire.AppendVarint(m, id)
+	for _, v := range []uint64{a, b} {
+		m = protowire.AppendTag(m, 2, protowire.VarintType)
+		m = protowire.AppendVarint(m, v)
+	}
+	return m
+}
+
+func TestKeyByUsesElementOptions(t *testing.T) {
+	var raw []byte
+	for _, id := range []uint64{2, 3} {
+		raw = protowire.AppendTag(raw, 5, protowire.BytesType)
+		raw = protowire.AppendBytes(raw, keyByItem(id, 7, 8))
+	}
+	// tag 2 在当前层级配置为字符串，元素的key为2时不能使用它的选择
+	var opts Options
+	err := json.Unmarshal([]byte(`{
+		"2": {"type": "string", "plural": true},
+		"5": {"type": "message", "key_by": "1", "options": {"2": {"type": "varint", "plural": false}}}
+	}`), &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode(raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"5_message":{"2":{"1_varint":2,"2_varint":[7,8]},"3":{"1_varint":3,"2_varint":[7,8]}}}`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
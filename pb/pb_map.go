@@ -0,0 +1,164 @@
+package pb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// mapKeyTag map entry中key的tag
+	mapKeyTag = 1
+	// mapValueTag map entry中value的tag
+	mapValueTag = 2
+)
+
+// readMapEntry 解析map字段的一个entry，将key和value合并到tag对应的json对象中
+// map字段序列化为repeated的entry message，entry中tag为1的字段是key，tag为2的字段是value
+// entry的选择为tag对应的嵌套选择，可以分别指定key和value的类型
+// entry不是恰好包含一个标量key和一个value时，按普通message输出并记录警告
+func readMapEntry(st *decodeState, data []byte, tag uint64, opts Options, result JSONResult) error {
+	entry, err := decode(st, data, opts.GetOptionsByTag(strconv.FormatUint(tag, 10)))
+	if err != nil {
+		return err
+	}
+	key, value, ok := mapEntryKeyValue(entry)
+	if !ok {
+		st.warn(tag, data, "map entry without exactly one scalar key and one value")
+		result.Append(fieldKey(Message, tag), entry)
+		return nil
+	}
+	typeName := fieldKey(Map, tag)
+	m, ok := result[typeName].(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{}
+		result[typeName] = m
+	}
+	// 与protobuf一致，重复的key以最后出现的为准
+	m[key] = value
+	return nil
+}
+
+// mapEntryKeyValue 获取entry中的key和value，key转换为字符串
+func mapEntryKeyValue(entry JSONResult) (string, interface{}, bool) {
+	if len(entry) != 2 {
+		return "", nil, false
+	}
+	var key string
+	var value interface{}
+	var hasKey, hasValue bool
+	for k, v := range entry {
+		if _, ok := v.([]interface{}); ok {
+			return "", nil, false
+		}
+		switch keyTag(k) {
+		case mapKeyTag:
+			switch v.(type) {
+			case string, bool, int32, int64, uint64:
+				key, hasKey = fmt.Sprint(v), true
+			}
+		case mapValueTag:
+			value, hasValue = v, true
+		}
+	}
+	return key, value, hasKey && hasValue
+}
+
+// encodeMap 序列化map字段，每个key序列化为一个entry message，按照key排序保证输出稳定
+// key和value的类型使用字段嵌套选择中tag为1和2的类型，没有配置时根据值推测，
+// 如数字形式的key序列化为varint，没有配置时无法还原数字形式的string key
+func encodeMap(st *encodeState, buf []byte, f encodedField) ([]byte, error) {
+	m, ok := asMap(f.value)
+	if !ok {
+		return nil, errInvalidValue
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	keyTyp := f.opts.GetTypeByTag(strconv.Itoa(mapKeyTag))
+	valueTyp := f.opts.GetTypeByTag(strconv.Itoa(mapValueTag))
+	for _, k := range keys {
+		kt := keyTyp
+		if kt == Unkown {
+			kt = inferKeyType(k)
+		}
+		vt := valueTyp
+		if vt == Unkown {
+			vt = inferValueType(m[k])
+		}
+		entry, err := encodeField(st, nil, encodedField{tag: mapKeyTag, typ: kt, value: mapKeyValue(kt, k)})
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k, err)
+		}
+		entry, err = encodeField(st, entry, newEncodedField("", mapValueTag, vt, m[k], f.opts))
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k, err)
+		}
+		buf = protowire.AppendTag(buf, f.tag, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, entry)
+	}
+	return buf, nil
+}
+
+// inferKeyType 推测没有配置类型的map key的类型
+func inferKeyType(key string) Type {
+	if _, err := strconv.ParseInt(key, 10, 64); err == nil {
+		return Int64
+	}
+	if _, err := strconv.ParseUint(key, 10, 64); err == nil {
+		return UInt
+	}
+	if key == "true" || key == "false" {
+		return Bool
+	}
+	return String
+}
+
+// mapKeyValue 将字符串形式的map key转换为对应类型的值
+func mapKeyValue(typ Type, key string) interface{} {
+	switch typ {
+	case String, Bytes, Base64, Printable:
+		return key
+	case Bool:
+		return key == "true"
+	}
+	return json.Number(key)
+}
+
+// inferValueType 推测没有配置类型的map value的类型
+func inferValueType(value interface{}) Type {
+	if m, ok := asMap(value); ok {
+		if _, ok := m[anyTypeKey]; ok {
+			return Any
+		}
+		return Message
+	}
+	switch value.(type) {
+	case string:
+		return String
+	case bool:
+		return Bool
+	case float32:
+		return Float
+	case int, int32, int64:
+		return Int64
+	case uint32, uint64:
+		return UInt
+	}
+	s, err := numberString(value)
+	if err != nil {
+		return Unkown
+	}
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return Int64
+	}
+	if _, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return UInt
+	}
+	return Double
+}
@@ -0,0 +1,89 @@
+package pb
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// mapEntry 构造map字段的一个entry
+func mapEntry(key, value []byte) []byte {
+	var entry []byte
+	entry = append(entry, key...)
+	return append(entry, value...)
+}
+
+func TestEncodeMapRoundTrip(t *testing.T) {
+	var sub []byte
+	sub = protowire.AppendTag(sub, 1, protowire.BytesType)
+	sub = protowire.AppendString(sub, "x")
+
+	var raw []byte
+	// map<string, sint32>，key按照字典序出现
+	for _, kv := range []struct {
+		key   string
+		value int64
+	}{{"a", -1}, {"b", 2}} {
+		key := protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), kv.key)
+		value := protowire.AppendVarint(protowire.AppendTag(nil, 2, protowire.VarintType), protowire.EncodeZigZag(kv.value))
+		raw = protowire.AppendTag(raw, 3, protowire.BytesType)
+		raw = protowire.AppendBytes(raw, mapEntry(key, value))
+	}
+	// map<int64, message>
+	key := protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 7)
+	value := protowire.AppendBytes(protowire.AppendTag(nil, 2, protowire.BytesType), sub)
+	raw = protowire.AppendTag(raw, 4, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, mapEntry(key, value))
+
+	var opts Options
+	err := json.Unmarshal([]byte(`{
+		"3": {"type": "map", "options": {"1": "string", "2": "sint"}},
+		"4": {"type": "map", "options": {"1": "int64", "2": {"type": "message", "options": {"1": "string"}}}}
+	}`), &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := Decode(raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"3_map":{"a":-1,"b":2},"4_map":{"7":{"1_string":"x"}}}`
+	if js != want {
+		t.Fatalf("decode got %s, want %s", js, want)
+	}
+	encoded, err := EncodeWithOptions(js, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, raw) {
+		t.Errorf("encode got %x, want %x", encoded, raw)
+	}
+}
+
+func TestEncodeMapInferredTypes(t *testing.T) {
+	var raw []byte
+	for _, kv := range []struct {
+		key   string
+		value uint64
+	}{{"a", 1}, {"b", 300}} {
+		key := protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), kv.key)
+		value := protowire.AppendVarint(protowire.AppendTag(nil, 2, protowire.VarintType), kv.value)
+		raw = protowire.AppendTag(raw, 5, protowire.BytesType)
+		raw = protowire.AppendBytes(raw, mapEntry(key, value))
+	}
+	opts := Options{"5": "map"}
+	js, err := Decode(raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有选择时根据值推测key和value的类型
+	encoded, err := Encode(js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, raw) {
+		t.Errorf("encode got %x, want %x", encoded, raw)
+	}
+}
@@ -0,0 +1,47 @@
+package pb
+
+import (
+	"strconv"
+)
+
+// applyNumbersAsStrings 将当前层级的所有数值转换为字符串，嵌套的message在自己的层级转换
+// 数组的元素以及flags、enum、时间戳等值对象中的数值同样转换，bool和null不变
+func applyNumbersAsStrings(result JSONResult) {
+	for k, v := range result {
+		if _, ok := v.(JSONResult); ok {
+			continue
+		}
+		result[k] = numberToString(v)
+	}
+}
+
+// numberToString 将值中的数值转换为字符串
+func numberToString(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []interface{}:
+		for i, item := range v {
+			if _, ok := item.(JSONResult); !ok {
+				v[i] = numberToString(item)
+			}
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = numberToString(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,86 @@
+package pb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	// errUnknownTypeName 类型名称不在namesToType中
+	errUnknownTypeName = errors.New("unknown type name")
+)
+
+// OptionsBuilder 构建Options，避免手写嵌套的map和 Noptions 这样的key
+// 如 NewOptionsBuilder().SetType(5, "int32").SetMessage(7, sub).Build()
+// 出现错误后后续的调用不再生效，错误在Build时返回
+type OptionsBuilder struct {
+	opts Options
+	err  error
+}
+
+// NewOptionsBuilder 创建一个空的OptionsBuilder
+func NewOptionsBuilder() *OptionsBuilder {
+	return &OptionsBuilder{opts: Options{}}
+}
+
+// SetType 设置tag对应字段的类型，name为namesToType中的名称，如 int32、strings、packed.int32s
+func (b *OptionsBuilder) SetType(tag uint64, name string) *OptionsBuilder {
+	if b.err != nil {
+		return b
+	}
+	if _, ok := namesToType[name]; !ok {
+		b.err = fmt.Errorf("%w %q for field %d", errUnknownTypeName, name, tag)
+		return b
+	}
+	b.opts[strconv.FormatUint(tag, 10)] = name
+	return b
+}
+
+// SetMessage 设置tag对应字段为嵌套的message，sub为message中字段的选择，可以为nil
+func (b *OptionsBuilder) SetMessage(tag uint64, sub *OptionsBuilder) *OptionsBuilder {
+	if b.err != nil {
+		return b
+	}
+	sTag := strconv.FormatUint(tag, 10)
+	b.opts[sTag] = TypeName(Message)
+	if sub == nil {
+		return b
+	}
+	if sub.err != nil {
+		b.err = fmt.Errorf("field %d: %w", tag, sub.err)
+		return b
+	}
+	b.opts[GetOptionsKey(sTag)] = map[string]interface{}(sub.opts)
+	return b
+}
+
+// SetEnum 设置tag对应字段为枚举，names为枚举值和名称的映射
+func (b *OptionsBuilder) SetEnum(tag uint64, names map[int32]string) *OptionsBuilder {
+	if b.err != nil {
+		return b
+	}
+	enum := make(map[string]interface{}, len(names))
+	for number, name := range names {
+		enum[strconv.FormatInt(int64(number), 10)] = name
+	}
+	b.opts[strconv.FormatUint(tag, 10)] = map[string]interface{}{fieldEnumKey: enum}
+	return b
+}
+
+// Set 设置全局选择，如 Set(OptionMaxDepth, 10)
+func (b *OptionsBuilder) Set(key string, value interface{}) *OptionsBuilder {
+	if b.err != nil {
+		return b
+	}
+	b.opts[key] = value
+	return b
+}
+
+// Build 返回构建的Options，构建过程中出现错误时返回第一个错误
+func (b *OptionsBuilder) Build() (Options, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.opts, nil
+}
@@ -0,0 +1,191 @@
+package pb
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// fieldOrder message中字段第一次出现的顺序，同时引用message的结果，避免结果被回收后地址被复用
+type fieldOrder struct {
+	result JSONResult
+	index  map[uint64]int
+}
+
+// OrderedResult 按照字段出现的顺序保存的解析结果，序列化为json时保持该顺序
+// 与JSONResult的添加规则一致，相同的键变为数组，数组的位置为键第一次出现的位置
+type OrderedResult struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+var _ Result = (*OrderedResult)(nil)
+
+// NewOrderedResult 创建一个空的OrderedResult
+func NewOrderedResult() *OrderedResult {
+	return &OrderedResult{values: map[string]interface{}{}}
+}
+
+// Append 往结果中添加数据，遇到相同的键则变为数组
+func (o *OrderedResult) Append(key string, value interface{}) {
+	temp, ok := o.values[key]
+	if !ok {
+		o.keys = append(o.keys, key)
+		o.values[key] = value
+		return
+	}
+	if items, ok := temp.([]interface{}); ok {
+		o.values[key] = append(items, value)
+		return
+	}
+	o.values[key] = []interface{}{temp, value}
+}
+
+// AppendArrayItem 往结果中对应键的数组中添加元素
+func (o *OrderedResult) AppendArrayItem(key string, value interface{}) {
+	if _, ok := o.values[key]; ok {
+		o.Append(key, value)
+		return
+	}
+	o.keys = append(o.keys, key)
+	o.values[key] = []interface{}{value}
+}
+
+// Get 获取键对应的值
+func (o *OrderedResult) Get(key string) (interface{}, bool) {
+	value, ok := o.values[key]
+	return value, ok
+}
+
+// Set 设置键对应的值，已有的键保持原来的位置
+func (o *OrderedResult) Set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Keys 按照出现顺序返回所有的键
+func (o *OrderedResult) Keys() []string {
+	return o.keys
+}
+
+// Len 键的数量
+func (o *OrderedResult) Len() int {
+	return len(o.keys)
+}
+
+// MarshalJSON 按照键出现的顺序输出json对象
+func (o *OrderedResult) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// recordTag 记录字段第一次出现的位置
+func (d *messageDecoder) recordTag(tag uint64) {
+	if d.seen == nil {
+		d.seen = map[uint64]struct{}{}
+	}
+	if _, ok := d.seen[tag]; ok {
+		return
+	}
+	d.seen[tag] = struct{}{}
+	d.order = append(d.order, tag)
+}
+
+// recordOrder 记录message的结果中字段出现的顺序
+func (s *decodeState) recordOrder(result JSONResult, order []uint64) {
+	index := make(map[uint64]int, len(order))
+	for i, tag := range order {
+		index[tag] = i
+	}
+	s.orders[reflect.ValueOf(result).Pointer()] = fieldOrder{result: result, index: index}
+}
+
+// orderedResult 将修复TagType名称后的结果转换为按照字段出现顺序输出的OrderedResult
+// 没有记录顺序的字段按key排在后面，扩展字段分组等保留key排在最后
+// f不为nil时使用f重新生成key，与key_formatter的规则一致
+func (s *decodeState) orderedResult(res JSONResult, f KeyFormatter) *OrderedResult {
+	return s.orderedMessage(res, s.orders[reflect.ValueOf(res).Pointer()].index, f)
+}
+
+// orderedMessage 按照index中的顺序转换一个message的结果
+func (s *decodeState) orderedMessage(res JSONResult, index map[uint64]int, f KeyFormatter) *OrderedResult {
+	keys := make([]string, 0, len(res))
+	for k := range res {
+		keys = append(keys, k)
+	}
+	position := func(k string) int {
+		if k == anyTypeKey {
+			return -1
+		}
+		if isReservedKey(k) {
+			return len(index) + 1
+		}
+		if i, ok := index[keyTag(k)]; ok {
+			return i
+		}
+		return len(index)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := position(keys[i]), position(keys[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return keys[i] < keys[j]
+	})
+
+	out := NewOrderedResult()
+	for _, k := range keys {
+		v := res[k]
+		if ext, ok := v.(JSONResult); ok && k == ExtensionsKey {
+			// 扩展字段分组中的字段与当前message的字段一同出现
+			out.Set(k, s.orderedMessage(ext, index, f))
+			continue
+		}
+		v = s.orderedValue(v, f)
+		if idx := strings.IndexByte(k, '_'); f != nil && !isReservedKey(k) && idx >= 0 {
+			k = f(keyTag(k), k[idx+1:])
+		}
+		out.Set(k, v)
+	}
+	return out
+}
+
+// orderedValue 转换值中嵌套的message，数组保持元素的顺序
+func (s *decodeState) orderedValue(v interface{}, f KeyFormatter) interface{} {
+	switch value := v.(type) {
+	case JSONResult:
+		return s.orderedResult(value, f)
+	case []interface{}:
+		for i, item := range value {
+			value[i] = s.orderedValue(item, f)
+		}
+	case map[string]interface{}:
+		// map字段以及key_by生成的对象中的message
+		for k, item := range value {
+			value[k] = s.orderedValue(item, f)
+		}
+	}
+	return v
+}
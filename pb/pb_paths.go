@@ -0,0 +1,48 @@
+package pb
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// DecodeWithPaths 将PB二进制数据反序列化为以tag路径为key的扁平结果
+// 路径由根开始的tag以.连接，如 1.3.5，repeated字段的元素带上下标，如 1.3[0].5
+// 路径与字段的值无关，适合对大量消息建立索引
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+func DecodeWithPaths(raw []byte, opts Options) (map[string]interface{}, error) {
+	res, err := decode(newDecodeState(raw, opts), raw, opts)
+	if err != nil {
+		return nil, err
+	}
+	flat := map[string]interface{}{}
+	flattenPaths("", res, flat)
+	return flat, nil
+}
+
+// flattenPaths 将结果展开到flat中
+// prefix: 当前message的路径
+func flattenPaths(prefix string, res JSONResult, flat map[string]interface{}) {
+	for k, v := range res {
+		path := strconv.FormatUint(keyTag(k), 10)
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		if items, ok := v.([]interface{}); ok {
+			for i, item := range items {
+				flattenPathValue(fmt.Sprintf("%s[%d]", path, i), item, flat)
+			}
+			continue
+		}
+		flattenPathValue(path, v, flat)
+	}
+}
+
+// flattenPathValue 展开单个值，嵌套的message继续展开
+func flattenPathValue(path string, value interface{}, flat map[string]interface{}) {
+	if nested, ok := value.(JSONResult); ok {
+		flattenPaths(path, nested, flat)
+		return
+	}
+	flat[path] = value
+}
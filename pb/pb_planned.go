@@ -0,0 +1,96 @@
+package pb
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DecodePlanned 分两个阶段将PB二进制数据反序列化为json数据
+// 第一阶段只扫描数据的结构，记录每个message的字段数并检查嵌套深度，不输出任何值
+// 嵌套过深的数据在第一阶段直接返回ErrTooDeep，第二阶段根据记录的字段数预分配结果
+// 深度通过全局选择max_depth配置，默认为100
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+func DecodePlanned(raw []byte, opts Options) (string, error) {
+	scanner := &shapeScanner{
+		rootCap:  cap(raw),
+		maxDepth: opts.getInt(OptionMaxDepth, DefaultMaxDepth),
+		hints:    map[int]int{},
+	}
+	if _, err := scanner.scan(raw, 0); err != nil {
+		return "", err
+	}
+
+	st := newDecodeState(raw, opts)
+	st.sizeHints = scanner.hints
+	res, err := decode(st, raw, opts)
+	if err != nil {
+		return "", err
+	}
+	return marshalResult(st, res, opts)
+}
+
+// shapeScanner 扫描数据的结构，与解析一样把可以解析为message的bytes字段视为嵌套类型
+type shapeScanner struct {
+	// rootCap 原始数据的容量，用于计算message在原始数据中的偏移
+	rootCap int
+	// maxDepth 允许的最大嵌套深度
+	maxDepth int
+	// hints message的偏移和字段数
+	hints map[int]int
+}
+
+// scan 扫描一个message，数据不是合法的message时返回false
+func (s *shapeScanner) scan(raw []byte, depth int) (bool, error) {
+	if depth > s.maxDepth {
+		// 只有确实是message的数据才算作嵌套
+		if len(raw) > 0 && isPlausibleMessage(raw) {
+			return false, fmt.Errorf("%w %d", ErrTooDeep, s.maxDepth)
+		}
+		return false, nil
+	}
+	data := raw
+	fields := 0
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 || num > MaxTagValue {
+			return false, nil
+		}
+		data = data[n:]
+		switch typ {
+		case protowire.VarintType, protowire.Fixed32Type, protowire.Fixed64Type:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return false, nil
+			}
+		case protowire.BytesType:
+			var value []byte
+			value, n = protowire.ConsumeBytes(data)
+			if n < 0 {
+				return false, nil
+			}
+			if _, err := s.scan(value, depth+1); err != nil {
+				return false, err
+			}
+		default:
+			return false, nil
+		}
+		data = data[n:]
+		fields++
+	}
+	s.hints[s.rootCap-cap(raw)] = fields
+	return true, nil
+}
+
+// isPlausibleMessage 判断数据的一层结构是否是合法的message
+func isPlausibleMessage(raw []byte) bool {
+	for len(raw) > 0 {
+		if !isPlausibleField(raw) {
+			return false
+		}
+		_, _, n := protowire.ConsumeField(raw)
+		raw = raw[n:]
+	}
+	return true
+}
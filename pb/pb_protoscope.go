@@ -0,0 +1,264 @@
+package pb
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DecodeProtoscope 将PB二进制数据输出为protoscope的文本格式，输出可以通过 protoscope -s 还原为原始数据
+// 长度前缀的字段使用{}，bytes使用反引号包裹的十六进制，字符串使用双引号，类型以注释的形式标注在行尾
+// 按照数据中字段的顺序输出，非最短编码的varint使用long-form标注，group使用!{}
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+func DecodeProtoscope(raw []byte, opts Options) (string, error) {
+	w := &protoscopeWriter{maxDepth: opts.getInt(OptionMaxDepth, DefaultMaxDepth)}
+	if err := w.writeMessage(raw, opts, 0); err != nil {
+		return "", err
+	}
+	return w.buf.String(), nil
+}
+
+// protoscopeWriter 输出protoscope文本的辅助结构
+type protoscopeWriter struct {
+	buf strings.Builder
+	// maxDepth 允许的最大嵌套深度
+	maxDepth int
+}
+
+// writeMessage 输出message的所有字段，每个字段一行
+func (w *protoscopeWriter) writeMessage(raw []byte, opts Options, depth int) error {
+	if depth >= w.maxDepth {
+		return fmt.Errorf("%w %d", ErrTooDeep, w.maxDepth)
+	}
+	indent := strings.Repeat("  ", depth)
+	for len(raw) > 0 {
+		num, wireType, n := protowire.ConsumeTag(raw)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		raw = raw[n:]
+		tag := strconv.FormatUint(uint64(num), 10)
+		typ := opts.GetTypeByTag(tag)
+		fmt.Fprintf(&w.buf, "%s%d: ", indent, num)
+
+		switch wireType {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(raw)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			raw = raw[n:]
+			w.writeVarint(v, n, typ)
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(raw)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			raw = raw[n:]
+			w.buf.WriteString(formatProtoscopeFixed32(v, typ))
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(raw)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			raw = raw[n:]
+			w.buf.WriteString(formatProtoscopeFixed64(v, typ))
+		case protowire.BytesType:
+			data, n := protowire.ConsumeBytes(raw)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			raw = raw[n:]
+			if err := w.writeBytes(data, tag, typ, opts, depth); err != nil {
+				return err
+			}
+		case protowire.StartGroupType:
+			// group中的字段与嵌套类型一样缩进输出，不包括结尾的EndGroup
+			group, n := protowire.ConsumeGroup(num, raw)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			raw = raw[n:]
+			w.buf.WriteString("!")
+			if err := w.writeNested(group, opts.GetOptionsByTag(tag), depth); err != nil {
+				return err
+			}
+		default:
+			return errUnknownType
+		}
+		if typ != Unkown {
+			w.buf.WriteString("  # " + strings.TrimPrefix(typeNamesFormat[typ], "%d_"))
+		}
+		w.buf.WriteString("\n")
+	}
+	return nil
+}
+
+// writeVarint 输出varint的值，n为编码的字节数
+func (w *protoscopeWriter) writeVarint(v uint64, n int, typ Type) {
+	if extra := n - protowire.SizeVarint(v); extra > 0 {
+		fmt.Fprintf(&w.buf, "long-form:%d ", extra)
+	}
+	w.buf.WriteString(formatProtoscopeVarint(v, typ))
+}
+
+// writeBytes 输出长度前缀的字段，指定为嵌套类型或者可以推测为嵌套类型时输出嵌套的字段
+func (w *protoscopeWriter) writeBytes(data []byte, tag string, typ Type, opts Options, depth int) error {
+	switch {
+	case typ == Bytes:
+		w.buf.WriteString("{`" + hex.EncodeToString(data) + "`}")
+	case typ == String || typ == Printable:
+		w.buf.WriteString("{" + quoteProtoscope(data) + "}")
+	case typ == Message || wktDecoders[typ] != nil:
+		return w.writeNested(data, opts.GetOptionsByTag(tag), depth)
+	case isPacked(typ):
+		return w.writePacked(data, typ)
+	default:
+		if len(data) == 0 {
+			w.buf.WriteString("{}")
+			return nil
+		}
+		// 先推测为嵌套类型，推测的类型同样以注释标注
+		sub := &protoscopeWriter{maxDepth: w.maxDepth}
+		if err := sub.writeMessage(data, opts.inherited(), depth+1); err == nil {
+			w.buf.WriteString("{\n")
+			w.buf.WriteString(sub.buf.String())
+			w.buf.WriteString(strings.Repeat("  ", depth) + "}  # message")
+			return nil
+		}
+		if isString(data) {
+			w.buf.WriteString("{" + quoteProtoscope(data) + "}  # string")
+			return nil
+		}
+		w.buf.WriteString("{`" + hex.EncodeToString(data) + "`}  # bytes")
+	}
+	return nil
+}
+
+// writeNested 输出嵌套类型
+func (w *protoscopeWriter) writeNested(data []byte, opts Options, depth int) error {
+	if len(data) == 0 {
+		w.buf.WriteString("{}")
+		return nil
+	}
+	w.buf.WriteString("{\n")
+	if err := w.writeMessage(data, opts, depth+1); err != nil {
+		return err
+	}
+	w.buf.WriteString(strings.Repeat("  ", depth) + "}")
+	return nil
+}
+
+// writePacked 输出packed类型，元素之间以空格分隔
+func (w *protoscopeWriter) writePacked(data []byte, typ Type) error {
+	elem := typ - Packed
+	items := []string{}
+	for len(data) > 0 {
+		switch wireType(elem) {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			item := formatProtoscopeVarint(v, elem)
+			if extra := n - protowire.SizeVarint(v); extra > 0 {
+				item = fmt.Sprintf("long-form:%d %s", extra, item)
+			}
+			items = append(items, item)
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			items = append(items, formatProtoscopeFixed32(v, elem))
+		default:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			items = append(items, formatProtoscopeFixed64(v, elem))
+		}
+	}
+	w.buf.WriteString("{" + strings.Join(items, " ") + "}")
+	return nil
+}
+
+// formatProtoscopeVarint 格式化varint的值，有符号类型输出负数，sint使用z后缀
+func formatProtoscopeVarint(v uint64, typ Type) string {
+	switch typ {
+	case Int32, Int64, Enum:
+		return strconv.FormatInt(int64(v), 10)
+	case SInt:
+		return strconv.FormatInt(protowire.DecodeZigZag(v), 10) + "z"
+	case Bool:
+		switch v {
+		case 0:
+			return "false"
+		case 1:
+			return "true"
+		}
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// formatProtoscopeFixed32 格式化fixed32的值，使用i32后缀
+func formatProtoscopeFixed32(v uint32, typ Type) string {
+	switch typ {
+	case Float:
+		if f := math.Float32frombits(v); !math.IsInf(float64(f), 0) && !math.IsNaN(float64(f)) {
+			return formatProtoscopeFloat(float64(f), 32) + "i32"
+		}
+	case SFixed32:
+		return strconv.FormatInt(int64(int32(v)), 10) + "i32"
+	}
+	return strconv.FormatUint(uint64(v), 10) + "i32"
+}
+
+// formatProtoscopeFixed64 格式化fixed64的值，使用i64后缀
+func formatProtoscopeFixed64(v uint64, typ Type) string {
+	switch typ {
+	case Double:
+		if f := math.Float64frombits(v); !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return formatProtoscopeFloat(f, 64) + "i64"
+		}
+	case SFixed64:
+		return strconv.FormatInt(int64(v), 10) + "i64"
+	}
+	return strconv.FormatUint(v, 10) + "i64"
+}
+
+// formatProtoscopeFloat 格式化浮点数，保证带有小数点或者指数以区别于整数
+func formatProtoscopeFloat(f float64, bitSize int) string {
+	s := strconv.FormatFloat(f, 'g', -1, bitSize)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// quoteProtoscope 将数据转换为protoscope的字符串，不可打印的字节使用\x转义
+func quoteProtoscope(data []byte) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range data {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package pb
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DecodeReader 从r中逐个字段读取PB二进制数据并反序列化为json数据，结果与Decode相同
+// 内存中同时只保存顶层的一个字段的数据(以及解析结果)，嵌套message和group需要完整读取后才能解析
+// coalesce和discriminator的字段需要在顶层结束时解析，其数据会保留到解析结束
+// r: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+func DecodeReader(r io.Reader, opts Options) (string, error) {
+	return DecodeReaderContext(context.Background(), r, opts)
+}
+
+// DecodeReaderContext 与DecodeReader相同，解析过程中定期检查ctx，ctx取消或超时时返回ctx.Err()
+func DecodeReaderContext(ctx context.Context, r io.Reader, opts Options) (string, error) {
+	br := bufio.NewReader(r)
+	st := newDecodeState(nil, opts)
+	st.ctx = ctx
+	if err := st.enter(); err != nil {
+		return "", err
+	}
+	d := newMessageDecoder(st, opts, 0)
+	for {
+		// 每个字段使用新的缓冲区，需要合并的字段会引用其中的数据
+		field, err := readStreamField(br, nil)
+		if errors.Is(err, io.EOF) && len(field) == 0 {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return "", err
+		}
+		if err := st.checkContext(); err != nil {
+			return "", err
+		}
+		// 不完整的字段同样交给解析器，返回与Decode一致的错误
+		st.rootCap = cap(field)
+		rest, derr := d.field(field)
+		if derr != nil {
+			return "", contextErr(ctx, derr)
+		}
+		if err != nil {
+			break
+		}
+		st.base += len(field) - len(rest)
+	}
+	res, err := d.finish()
+	st.leave()
+	if err != nil {
+		return "", err
+	}
+	return marshalResult(st, res, opts)
+}
+
+// readStreamField 从br中读取一个完整的字段(tag和值)追加到buf中
+// 开头没有数据时返回io.EOF，字段不完整时返回已读取的数据和io.ErrUnexpectedEOF
+func readStreamField(br *bufio.Reader, buf []byte) ([]byte, error) {
+	start := len(buf)
+	buf, err := readStreamVarint(br, buf)
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(buf) > start {
+			err = io.ErrUnexpectedEOF
+		}
+		return buf, err
+	}
+	num, typ, n := protowire.ConsumeTag(buf[start:])
+	if n < 0 {
+		// tag不合法，交给解析器报错
+		return buf, nil
+	}
+	switch typ {
+	case protowire.VarintType:
+		buf, err = readStreamVarint(br, buf)
+	case protowire.Fixed32Type:
+		buf, err = readStreamN(br, buf, 4)
+	case protowire.Fixed64Type:
+		buf, err = readStreamN(br, buf, 8)
+	case protowire.BytesType:
+		lenStart := len(buf)
+		if buf, err = readStreamVarint(br, buf); err != nil {
+			break
+		}
+		length, n := protowire.ConsumeVarint(buf[lenStart:])
+		if n < 0 {
+			return buf, nil
+		}
+		buf, err = readStreamN(br, buf, length)
+	case protowire.StartGroupType:
+		// 读取group中的字段，直到对应的EndGroup
+		for {
+			fieldStart := len(buf)
+			if buf, err = readStreamField(br, buf); err != nil {
+				break
+			}
+			endNum, endTyp, n := protowire.ConsumeTag(buf[fieldStart:])
+			if n < 0 || (endTyp == protowire.EndGroupType && endNum == num) {
+				break
+			}
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf, err
+}
+
+// readStreamVarint 从br中读取一个varint的原始字节追加到buf中
+// 不限制长度，超过64位的varint交给解析器处理(报错或者lenient_varint截断)
+func readStreamVarint(br *bufio.Reader, buf []byte) ([]byte, error) {
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return buf, err
+		}
+		buf = append(buf, c)
+		if c < 0x80 {
+			return buf, nil
+		}
+	}
+}
+
+// readStreamN 从br中读取n个字节追加到buf中，数据按实际读取的长度增长，避免按照不合法的长度预先分配
+func readStreamN(br *bufio.Reader, buf []byte, n uint64) ([]byte, error) {
+	for n > 0 {
+		chunk := n
+		if chunk > uint64(br.Size()) {
+			chunk = uint64(br.Size())
+		}
+		start := len(buf)
+		buf = append(buf, make([]byte, chunk)...)
+		read, err := io.ReadFull(br, buf[start:])
+		buf = buf[:start+read]
+		if err != nil {
+			return buf, err
+		}
+		n -= chunk
+	}
+	return buf, nil
+}
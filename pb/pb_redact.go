@@ -0,0 +1,81 @@
+package pb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// RedactFixed 使用固定的 *** 替换
+	RedactFixed = "fixed"
+	// RedactLength 使用与原值长度相同的 * 替换，非字符串的值使用固定的 ***
+	RedactLength = "length"
+	// RedactHash 使用值的sha256摘要的前16位替换，相同的值脱敏后相同，便于关联
+	RedactHash = "hash"
+
+	// redactMask 固定的脱敏占位符
+	redactMask = "***"
+	// redactHashLen 摘要保留的十六进制字符数
+	redactHashLen = 16
+)
+
+// redactStyle 获取tag对应的字段的脱敏方式，不需要脱敏时返回空字符串
+// 字段选择中的redact为true时使用全局的redact_style，也可以直接指定脱敏方式
+func (o Options) redactStyle(tag string, def string) string {
+	switch redact := o.getFieldOption(tag)[fieldRedactKey].(type) {
+	case bool:
+		if redact {
+			return def
+		}
+	case string:
+		return redact
+	}
+	return ""
+}
+
+// applyRedact 将配置了redact的字段的值替换为脱敏后的值，保留key
+// 嵌套类型的字段整体替换，数组的每个元素分别替换
+func applyRedact(st *decodeState, result JSONResult, opts Options) {
+	for tag := range opts {
+		style := opts.redactStyle(tag, st.redactStyle)
+		if style == "" {
+			continue
+		}
+		prefix := tag + "_"
+		for k, v := range result {
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			if items, ok := v.([]interface{}); ok {
+				for i, item := range items {
+					items[i] = redactValue(item, style)
+				}
+				continue
+			}
+			result[k] = redactValue(v, style)
+		}
+	}
+}
+
+// redactValue 按照脱敏方式替换一个值
+func redactValue(value interface{}, style string) string {
+	switch style {
+	case RedactLength:
+		if s, ok := value.(string); ok {
+			return strings.Repeat("*", utf8.RuneCountInString(s))
+		}
+	case RedactHash:
+		var data []byte
+		if s, ok := value.(string); ok {
+			data = []byte(s)
+		} else {
+			data, _ = json.Marshal(value)
+		}
+		sum := sha256.Sum256(data)
+		return "sha256:" + hex.EncodeToString(sum[:])[:redactHashLen]
+	}
+	return redactMask
+}
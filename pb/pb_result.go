@@ -0,0 +1,78 @@
+package pb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Result 解析结果的构建接口，JSONResult实现了该接口
+// 其它格式(如jce)的解析器通过该接口和KeyFormatter构建与pb一致的结果
+type Result interface {
+	// Append 往结果中添加数据，遇到相同的键则变为数组
+	Append(key string, value interface{})
+	// AppendArrayItem 往结果中对应键的数组中添加元素
+	AppendArrayItem(key string, value interface{})
+}
+
+var _ Result = JSONResult{}
+
+// ErrorKey 选择了best_effort时解析失败的错误信息在结果中的key，值包含error、offset和path
+const ErrorKey = "__error"
+
+// isReservedKey 判断是否是结果中不为 tag_type 格式的保留key，如ExtensionsKey和ErrorKey
+func isReservedKey(key string) bool {
+	return strings.HasPrefix(key, "__")
+}
+
+// KeyFormatter 根据tag和类型名称生成结果中的key
+type KeyFormatter func(tag uint64, typeName string) string
+
+// DefaultKeyFormatter pb默认的key格式，如 1_int32
+func DefaultKeyFormatter(tag uint64, typeName string) string {
+	return fmt.Sprintf("%d_%s", tag, typeName)
+}
+
+// PaddedKeyFormatter 返回tag补零到width位的key格式，如width为4时为 0001_int32
+func PaddedKeyFormatter(width int) KeyFormatter {
+	return func(tag uint64, typeName string) string {
+		return fmt.Sprintf("%0*d_%s", width, tag, typeName)
+	}
+}
+
+// TypeName 获取pb类型的名称，如Int32的名称为int32，未知类型返回空字符串
+func TypeName(typ Type) string {
+	return strings.TrimPrefix(typeNamesFormat[typ], "%d_")
+}
+
+// formatKeys 使用f重新生成结果中 tag_typeName 格式的key，嵌套的message同样处理
+func formatKeys(res JSONResult, f KeyFormatter) JSONResult {
+	out := make(JSONResult, len(res))
+	for k, v := range res {
+		v = formatValueKeys(v, f)
+		idx := strings.IndexByte(k, '_')
+		if isReservedKey(k) || idx < 0 {
+			out[k] = v
+			continue
+		}
+		out[f(keyTag(k), k[idx+1:])] = v
+	}
+	return out
+}
+
+// formatValueKeys 重新生成值中嵌套message的key
+func formatValueKeys(v interface{}, f KeyFormatter) interface{} {
+	switch value := v.(type) {
+	case JSONResult:
+		return formatKeys(value, f)
+	case []interface{}:
+		for i, item := range value {
+			value[i] = formatValueKeys(item, f)
+		}
+	case map[string]interface{}:
+		// map字段以及key_by生成的对象中的message
+		for k, item := range value {
+			value[k] = formatValueKeys(item, f)
+		}
+	}
+	return v
+}
@@ -0,0 +1,40 @@
+package pb
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// defaultResyncMaxScan DecodeResync默认最多跳过的字节数
+	defaultResyncMaxScan = 256
+)
+
+var (
+	// errResyncFailed 在扫描范围内找不到可以完整解析的位置
+	errResyncFailed = errors.New("no decodable position found")
+)
+
+// DecodeResync 从数据中间开始的抓包中恢复数据，结果是有损的
+// 从头逐字节向后查找，使剩余数据的每一层结构都是合法message并且可以完整解析的第一个位置，从该位置开始解析
+// 最多跳过resync_max_scan个字节，默认为256，避免大数据的扫描开销过大
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+// 返回json数据和开头被跳过的字节数
+func DecodeResync(raw []byte, opts Options) (js string, skipped int, err error) {
+	maxScan := opts.getInt(OptionResyncMaxScan, defaultResyncMaxScan)
+	for skipped = 0; skipped <= maxScan && skipped < len(raw); skipped++ {
+		data := raw[skipped:]
+		if !isPlausibleMessage(data) {
+			continue
+		}
+		st := newDecodeState(data, opts)
+		res, err := decode(st, data, opts)
+		if err != nil {
+			continue
+		}
+		js, err = marshalResult(st, res, opts)
+		return js, skipped, err
+	}
+	return "", 0, fmt.Errorf("%w within %d bytes", errResyncFailed, maxScan)
+}
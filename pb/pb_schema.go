@@ -0,0 +1,99 @@
+package pb
+
+import (
+	"strconv"
+)
+
+// streamSchema 从多个消息的解析结果中推断出的bytes字段类型，key为tag
+type streamSchema map[uint64]*schemaField
+
+// schemaField 推断出的字段类型
+type schemaField struct {
+	// typ Message、String或者Bytes
+	typ Type
+	// nested 嵌套类型的字段类型
+	nested streamSchema
+}
+
+// infer 从一个消息的解析结果中推断bytes字段的类型并与已有的类型合并，需要在修复TagType名称之前调用
+// 只推断用户没有配置的字段，用户指定为嵌套类型的字段推断其中的字段
+func (s streamSchema) infer(res JSONResult, opts Options) {
+	for k, v := range res {
+		tag := keyTag(k)
+		sTag := strconv.FormatUint(tag, 10)
+		items, ok := v.([]interface{})
+		if !ok {
+			items = []interface{}{v}
+		}
+		if isConfigured(opts, sTag) {
+			if opts.GetTypeByTag(sTag) != Message {
+				continue
+			}
+			for _, item := range items {
+				if nested, ok := item.(JSONResult); ok {
+					s.field(tag, Message).nested.infer(nested, opts.GetOptionsByTag(sTag))
+				}
+			}
+			continue
+		}
+		for _, item := range items {
+			switch value := item.(type) {
+			case JSONResult:
+				if f := s.field(tag, Message); f.typ == Message {
+					f.nested.infer(value, opts.inherited())
+				}
+			case string:
+				switch k {
+				case fieldKey(String, tag):
+					s.field(tag, String)
+				case fieldKey(Bytes, tag), fieldKey(Base64, tag):
+					s.field(tag, Bytes)
+				}
+			}
+		}
+	}
+}
+
+// field 获取tag对应的字段类型，类型不一致时放宽为Bytes
+func (s streamSchema) field(tag uint64, typ Type) *schemaField {
+	f, ok := s[tag]
+	if !ok {
+		f = &schemaField{typ: typ, nested: streamSchema{}}
+		s[tag] = f
+	} else if f.typ != typ {
+		f.typ = Bytes
+		f.nested = streamSchema{}
+	}
+	return f
+}
+
+// options 将推断出的类型与用户的选择合并为新的选择，用户的选择优先
+func (s streamSchema) options(opts Options) Options {
+	merged := make(Options, len(opts)+len(s))
+	for k, v := range opts {
+		merged[k] = v
+	}
+	for tag, f := range s {
+		sTag := strconv.FormatUint(tag, 10)
+		if isConfigured(opts, sTag) {
+			if opts.GetTypeByTag(sTag) == Message && len(f.nested) > 0 {
+				merged[GetOptionsKey(sTag)] = f.nested.options(opts.GetOptionsByTag(sTag))
+			}
+			continue
+		}
+		merged[sTag] = TypeName(f.typ)
+		if f.typ == Message {
+			merged[GetOptionsKey(sTag)] = f.nested.options(opts.inherited())
+		}
+	}
+	return merged
+}
+
+// isConfigured 判断用户是否配置了tag对应的字段
+func isConfigured(opts Options, tag string) bool {
+	if _, ok := opts[tag]; ok {
+		return true
+	}
+	_, ok := opts[GetOptionsKey(tag)]
+	return ok
+}
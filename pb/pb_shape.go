@@ -0,0 +1,71 @@
+package pb
+
+import (
+	"strings"
+)
+
+// DecodeShape 将PB二进制数据反序列化后只输出结构，值替换为类型名称
+// repeated字段输出为只有一个元素的数组，repeated message的元素为所有元素结构的并集
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+func DecodeShape(raw []byte, opts Options) (string, error) {
+	res, err := decode(newDecodeState(raw, opts), raw, opts)
+	if err != nil {
+		return "", err
+	}
+	return marshalResult(nil, shapeOf(res), opts)
+}
+
+// shapeOf 获取解析结果的结构，需要在修复TagType名称之前调用
+func shapeOf(res JSONResult) JSONResult {
+	shape := make(JSONResult, len(res))
+	for k, v := range res {
+		typeName := k
+		if idx := strings.IndexByte(k, '_'); idx > 0 {
+			typeName = k[idx+1:]
+		}
+		switch value := v.(type) {
+		case JSONResult:
+			shape[k] = shapeOf(value)
+		case []interface{}:
+			shape[k] = []interface{}{itemsShape(value, typeName)}
+		default:
+			shape[k] = typeName
+		}
+	}
+	return shape
+}
+
+// itemsShape 获取数组元素的结构，message元素合并为一个结构
+func itemsShape(items []interface{}, typeName string) interface{} {
+	var merged JSONResult
+	for _, item := range items {
+		msg, ok := item.(JSONResult)
+		if !ok {
+			return typeName
+		}
+		if merged == nil {
+			merged = JSONResult{}
+		}
+		mergeShape(merged, shapeOf(msg))
+	}
+	if merged == nil {
+		return typeName
+	}
+	return merged
+}
+
+// mergeShape 将结构src合并到dst，嵌套的message递归合并
+func mergeShape(dst, src JSONResult) {
+	for k, v := range src {
+		if old, ok := dst[k].(JSONResult); ok {
+			if nv, ok := v.(JSONResult); ok {
+				mergeShape(old, nv)
+				continue
+			}
+		}
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+}
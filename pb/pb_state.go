@@ -0,0 +1,272 @@
+package pb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// DefaultMaxDepth 默认允许的最大嵌套深度
+	DefaultMaxDepth = 100
+	// contextCheckInterval 检查ctx的间隔字段数
+	contextCheckInterval = 64
+)
+
+var (
+	// ErrTooDeep 数据的嵌套深度超出了限制
+	ErrTooDeep = errors.New("exceeded max message depth")
+)
+
+// decodeState 一次解析过程中共享的状态，嵌套解析时一并传递
+type decodeState struct {
+	// rootCap 原始数据的容量，用于计算子切片在原始数据中的偏移
+	rootCap int
+	// base 从io.Reader解析时，当前数据之前已经读取的字节数
+	base int
+	// skipUnknownWire 遇到未知wire type时跳过并继续解析(有损)
+	skipUnknownWire bool
+	// lenientVarint 超过64位的varint截断后继续解析
+	lenientVarint bool
+	// numbersAsStrings 所有的数值输出为字符串
+	numbersAsStrings bool
+	// varintInterpretations 未指定类型的varint同时输出各种可能的解释
+	varintInterpretations bool
+	// enumBoth 枚举同时输出名称和数值
+	enumBoth bool
+	// floatPrecision float和double保留的有效数字位数，0表示保持原值
+	floatPrecision int
+	// int64AsNumber 64位整数在安全范围内输出为数值
+	int64AsNumber bool
+	// nonFinite NaN和Inf输出的值，为nil时输出为名称字符串
+	nonFinite interface{}
+	// maxStringLen 字符串和bytes输出的最大长度，0表示不限制
+	maxStringLen int
+	// redactStyle 默认的脱敏方式
+	redactStyle string
+	// bestEffort 顶层message解析失败时返回已经解析的字段
+	bestEffort bool
+	// emptyAs 没有指定类型的空bytes字段输出的类型，为Message、String或Bytes
+	emptyAs Type
+	// strict 没有指定类型的bytes字段不推测类型，直接输出为bytes
+	strict bool
+	// speculativeMaxBytes 推测为嵌套类型的bytes字段的最大长度，0表示不限制
+	speculativeMaxBytes int
+	// diag 诊断信息，为nil时不收集
+	diag *Diagnostics
+	// reportGuesses 诊断信息中记录没有指定类型的bytes字段推测的类型
+	reportGuesses bool
+	// budget 输出预算，为nil时不限制
+	budget *budgetCounter
+	// bytesBase64 bytes数据使用base64编码
+	bytesBase64 bool
+	// depth 当前的嵌套深度
+	depth int
+	// maxDepth 允许的最大嵌套深度
+	maxDepth int
+	// maxTag 支持的tag最大值
+	maxTag uint64
+	// sizeHints 预先扫描得到的message偏移和字段数，用于预分配结果，为nil时不预分配
+	sizeHints map[int]int
+	// ctx 用于取消解析，为nil时不检查
+	ctx context.Context
+	// fields 已经解析的字段数，用于定期检查ctx
+	fields int
+	// orders 每个message中字段第一次出现的顺序，为nil时不记录
+	orders map[uintptr]fieldOrder
+	// types Decoder预先计算的每一层Options的tag到类型的映射，为nil时每次解析字段选择
+	types map[uintptr]map[string]Type
+}
+
+// newDecodeState 根据顶层的用户选择创建解析状态
+func newDecodeState(raw []byte, opts Options) *decodeState {
+	st := &decodeState{
+		rootCap:               cap(raw),
+		skipUnknownWire:       opts.getBool(OptionSkipUnknownWire),
+		strict:                opts.getBool(OptionStrict),
+		bestEffort:            opts.getBool(OptionBestEffort),
+		speculativeMaxBytes:   opts.getInt(OptionSpeculativeMaxBytes, 0),
+		enumBoth:              opts.getBool(OptionEnumBoth),
+		lenientVarint:         opts.getBool(OptionLenientVarint),
+		numbersAsStrings:      opts.getBool(OptionAllNumbersAsStrings),
+		varintInterpretations: opts.getBool(OptionVarintInterpretations),
+		maxDepth:              opts.getInt(OptionMaxDepth, DefaultMaxDepth),
+		bytesBase64:           opts[OptionBytesEncoding] == BytesEncodingBase64,
+		maxStringLen:          opts.getInt(OptionMaxStringLen, 0),
+		floatPrecision:        opts.getInt(OptionFloatPrecision, 0),
+		nonFinite:             opts[OptionNonFiniteAs],
+		int64AsNumber:         opts.getBool(OptionInt64AsNumber),
+		redactStyle:           RedactFixed,
+		budget:                newBudgetCounter(raw, opts),
+		reportGuesses:         opts.getBool(OptionReportGuesses),
+	}
+	switch opts[OptionEmptyAs] {
+	case EmptyAsString:
+		st.emptyAs = String
+	case EmptyAsBytes:
+		st.emptyAs = Bytes
+	default:
+		st.emptyAs = Message
+	}
+	if maxTag := opts.getInt(OptionMaxTag, 0); maxTag > 0 {
+		st.maxTag = uint64(maxTag)
+	} else {
+		st.maxTag = DefaultMaxTag
+	}
+	if opts.getBool(OptionOrdered) {
+		st.orders = map[uintptr]fieldOrder{}
+	}
+	if style, ok := opts[OptionRedactStyle].(string); ok && style != "" {
+		st.redactStyle = style
+	}
+	return st
+}
+
+// bytesValue 获取bytes数据展示的类型和值，根据bytes_encoding使用十六进制或者base64
+func (s *decodeState) bytesValue(data []byte) (Type, string) {
+	if s.bytesBase64 {
+		return Base64, TruncateBase64(data, s.maxStringLen)
+	}
+	return Bytes, TruncateHex(data, s.maxStringLen)
+}
+
+// checkContext 每解析contextCheckInterval个字段检查一次ctx，ctx取消或超时时返回ctx.Err()
+func (s *decodeState) checkContext() error {
+	if s.ctx == nil {
+		return nil
+	}
+	s.fields++
+	if s.fields%contextCheckInterval != 0 {
+		return nil
+	}
+	return s.ctx.Err()
+}
+
+// cancelled 判断ctx是否已经取消或超时
+func (s *decodeState) cancelled() bool {
+	return s.ctx != nil && s.ctx.Err() != nil
+}
+
+// enter 进入一层嵌套，超出最大深度时返回ErrTooDeep，返回nil时需要调用leave
+func (s *decodeState) enter() error {
+	if s.depth >= s.maxDepth {
+		return fmt.Errorf("%w %d", ErrTooDeep, s.maxDepth)
+	}
+	s.depth++
+	return nil
+}
+
+// leave 离开一层嵌套
+func (s *decodeState) leave() {
+	s.depth--
+}
+
+// speculative 返回用于推测解析的状态，推测解析时不做有损的恢复，tag不超过MaxTagValue
+func (s *decodeState) speculative() *decodeState {
+	if !s.skipUnknownWire && s.maxTag <= MaxTagValue {
+		return s
+	}
+	ns := *s
+	ns.skipUnknownWire = false
+	if ns.maxTag > MaxTagValue {
+		ns.maxTag = MaxTagValue
+	}
+	return &ns
+}
+
+// shouldSpeculate 判断未指定类型的bytes字段是否需要推测为嵌套类型
+// 过大的数据几乎不会是嵌套类型，跳过推测以节省递归解析的开销
+func (s *decodeState) shouldSpeculate(data []byte) bool {
+	return s.speculativeMaxBytes <= 0 || len(data) <= s.speculativeMaxBytes
+}
+
+// countOutput 累加估算的输出字节数，超出预算时返回错误
+func (s *decodeState) countOutput(n int) error {
+	return s.budget.add(n)
+}
+
+// countField 累加字段总数，超出max_fields时返回错误
+func (s *decodeState) countField() error {
+	return s.budget.addField()
+}
+
+// outputMark 记录当前估算的输出字节数和字段总数，推测解析失败时用于回滚
+func (s *decodeState) outputMark() budgetMark {
+	if s.budget == nil {
+		return budgetMark{}
+	}
+	return budgetMark{output: s.budget.output, fields: s.budget.fields}
+}
+
+// resetOutput 回滚估算的输出字节数和字段总数
+func (s *decodeState) resetOutput(mark budgetMark) {
+	if s.budget != nil {
+		s.budget.output = mark.output
+		s.budget.fields = mark.fields
+	}
+}
+
+// warn 记录字段的警告，raw为字段的数据
+func (s *decodeState) warn(tag uint64, raw []byte, format string, args ...interface{}) {
+	if s.diag == nil {
+		return
+	}
+	s.diag.addWarning(tag, s.offset(raw), fmt.Sprintf(format, args...))
+}
+
+// guess 记录没有指定类型的bytes字段推测的类型，alternatives为数据同样可以解析为的其它类型
+func (s *decodeState) guess(tag uint64, raw []byte, typ Type, alternatives ...Type) {
+	if s.diag == nil || !s.reportGuesses {
+		return
+	}
+	g := Guess{Tag: tag, Offset: s.offset(raw), Type: TypeName(typ), Confidence: GuessLikely}
+	if len(alternatives) > 0 {
+		g.Confidence = GuessAmbiguous
+		for _, alt := range alternatives {
+			g.Alternatives = append(g.Alternatives, TypeName(alt))
+		}
+	}
+	s.diag.addGuess(g)
+}
+
+// sizeHint 获取message预先扫描得到的字段数
+func (s *decodeState) sizeHint(raw []byte) int {
+	if s.sizeHints == nil {
+		return 0
+	}
+	return s.sizeHints[s.offset(raw)]
+}
+
+// offset 计算raw在原始数据中的偏移
+// 解析过程中只会从前面截断切片，因此可以通过容量的差值得到偏移
+func (s *decodeState) offset(raw []byte) int {
+	return s.base + s.rootCap - cap(raw)
+}
+
+// skip 从raw开始跳过无法解析的数据，直到找到一个看起来合法的字段，返回剩余的数据
+func (s *decodeState) skip(raw []byte, reason string) []byte {
+	n := 1
+	for ; n < len(raw); n++ {
+		if isPlausibleField(raw[n:]) {
+			break
+		}
+	}
+	s.diag.addSkipped(s.offset(raw), n, reason)
+	return raw[n:]
+}
+
+// isPlausibleField 判断raw是否以一个合法的字段开头
+func isPlausibleField(raw []byte) bool {
+	num, typ, length := protowire.ConsumeTag(raw)
+	if length < 0 || num > MaxTagValue {
+		return false
+	}
+	switch Type(typ) {
+	case Varint, Fixed32, Fixed64, Bytes:
+	default:
+		return false
+	}
+	return protowire.ConsumeFieldValue(num, typ, raw[length:]) >= 0
+}
@@ -0,0 +1,162 @@
+package pb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Framing 多个消息拼接时每个消息长度前缀的编码方式
+type Framing string
+
+const (
+	// FramingVarint varint长度前缀，即protobuf标准的delimited格式
+	FramingVarint Framing = "varint"
+	// FramingU32BE 4字节大端长度前缀
+	FramingU32BE Framing = "u32be"
+	// FramingU32LE 4字节小端长度前缀
+	FramingU32LE Framing = "u32le"
+)
+
+var (
+	// errTruncatedFrame 消息数据比长度前缀中的长度短
+	errTruncatedFrame = errors.New("truncated frame")
+	// errTruncatedPrefix 长度前缀不完整
+	errTruncatedPrefix = errors.New("truncated length prefix")
+	// errUnknownFraming 未知的长度前缀编码方式
+	errUnknownFraming = errors.New("unknown framing")
+)
+
+// DecodeDelimitedStream 解析多个带长度前缀的消息拼接而成的数据，返回每个消息的json
+// 数据不完整时返回已经完整解析的消息以及包含已解析数量的错误
+// 全局选择consistent_schema为true时所有消息中未配置类型的bytes字段使用一致的类型，见decodeConsistentStream
+// raw: 要进行反序列化的数据
+// framing: 长度前缀的编码方式
+// opts: 用户针对每个字段的干预选择，对每个消息都生效
+func DecodeDelimitedStream(raw []byte, framing Framing, opts Options) ([]string, error) {
+	if opts.getBool(OptionConsistentSchema) {
+		return decodeConsistentStream(raw, framing, opts)
+	}
+	results := []string{}
+	for len(raw) > 0 {
+		var msg []byte
+		var err error
+		msg, raw, err = nextFrame(raw, framing)
+		if err != nil {
+			return results, fmt.Errorf("%w after %d complete messages", err, len(results))
+		}
+		js, err := Decode(msg, opts)
+		if err != nil {
+			return results, fmt.Errorf("message %d: %w", len(results), err)
+		}
+		results = append(results, js)
+	}
+	return results, nil
+}
+
+// DecodeDelimited 解析多个带varint长度前缀的消息拼接而成的数据，即protobuf标准的delimited格式
+// 与DecodeDelimitedStream使用FramingVarint相同
+func DecodeDelimited(raw []byte, opts Options) ([]string, error) {
+	return DecodeDelimitedStream(raw, FramingVarint, opts)
+}
+
+// DecodeDelimitedTo 解析多个带varint长度前缀的消息拼接而成的数据，每个消息的json作为一行写入w(JSON Lines)
+// 与DecodeDelimitedStreamTo使用FramingVarint相同
+func DecodeDelimitedTo(w io.Writer, raw []byte, opts Options) error {
+	return DecodeDelimitedStreamTo(w, raw, FramingVarint, opts)
+}
+
+// DecodeDelimitedStreamTo 解析多个带长度前缀的消息拼接而成的数据，每解析一个消息就将其json作为一行写入w
+// 不保存所有消息的结果，适合很大的数据，consistent_schema需要保存所有消息，不生效
+// 数据不完整时已经完整解析的消息已经写入w，返回包含已解析数量的错误
+// w: 输出，每行一个紧凑的json对象
+// raw: 要进行反序列化的数据
+// framing: 长度前缀的编码方式
+// opts: 用户针对每个字段的干预选择，对每个消息都生效
+func DecodeDelimitedStreamTo(w io.Writer, raw []byte, framing Framing, opts Options) error {
+	for count := 0; len(raw) > 0; count++ {
+		var msg []byte
+		var err error
+		msg, raw, err = nextFrame(raw, framing)
+		if err != nil {
+			return fmt.Errorf("%w after %d complete messages", err, count)
+		}
+		js, err := Decode(msg, opts)
+		if err != nil {
+			return fmt.Errorf("message %d: %w", count, err)
+		}
+		if _, err = io.WriteString(w, js+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextFrame 读取一个带长度前缀的消息，返回消息数据和剩余的数据
+func nextFrame(raw []byte, framing Framing) (msg []byte, rest []byte, err error) {
+	var length uint64
+	var n int
+	switch framing {
+	case FramingVarint:
+		length, n = protowire.ConsumeVarint(raw)
+		if n < 0 {
+			return nil, nil, fmt.Errorf("%w: %v", errTruncatedPrefix, protowire.ParseError(n))
+		}
+	case FramingU32BE, FramingU32LE:
+		if len(raw) < 4 {
+			return nil, nil, fmt.Errorf("%w: %d bytes left", errTruncatedPrefix, len(raw))
+		}
+		n = 4
+		if framing == FramingU32BE {
+			length = uint64(binary.BigEndian.Uint32(raw))
+		} else {
+			length = uint64(binary.LittleEndian.Uint32(raw))
+		}
+	default:
+		return nil, nil, fmt.Errorf("%w: %s", errUnknownFraming, framing)
+	}
+	raw = raw[n:]
+	if length > uint64(len(raw)) {
+		return nil, nil, fmt.Errorf("%w: length %d, %d bytes left", errTruncatedFrame, length, len(raw))
+	}
+	return raw[:length], raw[length:], nil
+}
+
+// decodeConsistentStream 使所有消息的字段类型保持一致的解析
+// 先推测解析所有消息，合并每个消息中推测出的bytes字段类型，同一字段的类型不一致时放宽为bytes
+// 再使用合并后的类型重新解析所有消息，避免同一字段在不同消息中输出为不同的类型
+func decodeConsistentStream(raw []byte, framing Framing, opts Options) ([]string, error) {
+	var msgs [][]byte
+	var streamErr error
+	schema := streamSchema{}
+	for len(raw) > 0 {
+		var msg []byte
+		var err error
+		msg, raw, err = nextFrame(raw, framing)
+		if err != nil {
+			streamErr = fmt.Errorf("%w after %d complete messages", err, len(msgs))
+			break
+		}
+		res, err := decode(newDecodeState(msg, opts), msg, opts)
+		if err != nil {
+			streamErr = fmt.Errorf("message %d: %w", len(msgs), err)
+			break
+		}
+		schema.infer(res, opts)
+		msgs = append(msgs, msg)
+	}
+
+	schemaOpts := schema.options(opts)
+	results := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		js, err := Decode(msg, schemaOpts)
+		if err != nil {
+			return results, fmt.Errorf("message %d: %w", len(results), err)
+		}
+		results = append(results, js)
+	}
+	return results, streamErr
+}
@@ -0,0 +1,57 @@
+package pb
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestDecodeDelimitedStream(t *testing.T) {
+	msgs := [][]byte{
+		protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1),
+		protowire.AppendVarint(protowire.AppendTag(nil, 2, protowire.VarintType), 2),
+	}
+	want := []string{`{"1_varint":1}`, `{"2_varint":2}`}
+	prefixes := map[Framing]func([]byte, int) []byte{
+		FramingVarint: func(b []byte, n int) []byte { return protowire.AppendVarint(b, uint64(n)) },
+		FramingU32BE:  func(b []byte, n int) []byte { return binary.BigEndian.AppendUint32(b, uint32(n)) },
+		FramingU32LE:  func(b []byte, n int) []byte { return binary.LittleEndian.AppendUint32(b, uint32(n)) },
+	}
+	for framing, prefix := range prefixes {
+		t.Run(string(framing), func(t *testing.T) {
+			var raw []byte
+			for _, msg := range msgs {
+				raw = append(prefix(raw, len(msg)), msg...)
+			}
+			got, err := DecodeDelimitedStream(raw, framing, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+
+			// 最后一个消息不完整时返回已经完整解析的消息
+			got, err = DecodeDelimitedStream(raw[:len(raw)-1], framing, nil)
+			if !errors.Is(err, errTruncatedFrame) || !strings.Contains(err.Error(), "after 1 complete messages") {
+				t.Errorf("got error %v, want truncated frame after 1 complete messages", err)
+			}
+			if !reflect.DeepEqual(got, want[:1]) {
+				t.Errorf("got %v, want %v", got, want[:1])
+			}
+		})
+	}
+}
+
+func TestDecodeDelimitedStreamErrors(t *testing.T) {
+	if _, err := DecodeDelimitedStream([]byte{0, 0}, FramingU32BE, nil); !errors.Is(err, errTruncatedPrefix) {
+		t.Errorf("got %v, want %v", err, errTruncatedPrefix)
+	}
+	if _, err := DecodeDelimitedStream([]byte{0}, "u16be", nil); !errors.Is(err, errUnknownFraming) {
+		t.Errorf("got %v, want %v", err, errUnknownFraming)
+	}
+}
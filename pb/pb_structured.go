@@ -0,0 +1,86 @@
+package pb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// structuredFieldFormat 结构化输出时字段的key
+const structuredFieldFormat = "field_%d"
+
+// structuredResult 将解析结果转换为结构化的字段，tag和类型作为单独的值输出
+// 同一tag有多种类型时(如packed和非packed)合并为一个数组
+func structuredResult(res JSONResult) map[string]interface{} {
+	keys := make([]string, 0, len(res))
+	for k := range res {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make(map[string]interface{}, len(res))
+	for _, k := range keys {
+		v := res[k]
+		if ext, ok := v.(JSONResult); ok && k == ExtensionsKey {
+			out[k] = structuredResult(ext)
+			continue
+		}
+		idx := strings.IndexByte(k, '_')
+		if idx < 0 || isReservedKey(k) {
+			out[k] = v
+			continue
+		}
+		tag := keyTag(k)
+		typeName := k[idx+1:]
+		key := fmt.Sprintf(structuredFieldFormat, tag)
+		items, isArray := v.([]interface{})
+		if !isArray {
+			field := structuredField(tag, typeName, v)
+			if prev, ok := out[key]; ok {
+				out[key] = appendStructured(prev, field)
+				continue
+			}
+			out[key] = field
+			continue
+		}
+		fields := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			fields = append(fields, structuredField(tag, typeName, item))
+		}
+		if prev, ok := out[key]; ok {
+			out[key] = appendStructured(prev, fields...)
+			continue
+		}
+		out[key] = fields
+	}
+	return out
+}
+
+// structuredField 生成一个结构化的字段
+func structuredField(tag uint64, typeName string, value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case JSONResult:
+		value = structuredResult(v)
+	case map[string]interface{}:
+		// map字段的值中的message同样转换
+		for k, item := range v {
+			if nj, ok := item.(JSONResult); ok {
+				v[k] = structuredResult(nj)
+			}
+		}
+	}
+	return map[string]interface{}{
+		"tag":   tag,
+		"type":  typeName,
+		"value": value,
+	}
+}
+
+// appendStructured 将字段添加到已有的字段或者数组中
+func appendStructured(prev interface{}, fields ...interface{}) []interface{} {
+	items, ok := prev.([]interface{})
+	if !ok {
+		items = []interface{}{prev}
+	}
+	return append(items, fields...)
+}
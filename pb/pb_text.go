@@ -0,0 +1,76 @@
+package pb
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// errInvalidHex 十六进制文本格式错误
+	errInvalidHex = errors.New("invalid hex input")
+	// errInvalidBase64 base64文本格式错误
+	errInvalidBase64 = errors.New("invalid base64 input")
+)
+
+// ParseHex 解析从日志或者抓包工具中复制的十六进制文本
+// 忽略首尾和中间的空白，每一段可以带0x前缀，如 "0a 03 61 62 63"、"0x0a03616263"
+func ParseHex(text string) ([]byte, error) {
+	var sb strings.Builder
+	for _, part := range strings.Fields(text) {
+		if len(part) >= 2 && part[0] == '0' && (part[1] == 'x' || part[1] == 'X') {
+			part = part[2:]
+		}
+		sb.WriteString(part)
+	}
+	s := sb.String()
+	if len(s)%2 != 0 {
+		return nil, fmt.Errorf("%w: odd length %d", errInvalidHex, len(s))
+	}
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidHex, err)
+	}
+	return data, nil
+}
+
+// ParseBase64 解析base64文本，忽略首尾和中间的空白，兼容url安全的编码和省略的填充
+func ParseBase64(text string) ([]byte, error) {
+	s := strings.Join(strings.Fields(text), "")
+	encoding := base64.StdEncoding
+	if strings.ContainsAny(s, "-_") {
+		encoding = base64.URLEncoding
+	}
+	if !strings.HasSuffix(s, "=") && len(s)%4 != 0 {
+		encoding = encoding.WithPadding(base64.NoPadding)
+	}
+	data, err := encoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidBase64, err)
+	}
+	return data, nil
+}
+
+// DecodeHex 将十六进制文本表示的PB数据反序列化为json数据，文本格式见ParseHex
+// hexStr: 十六进制文本
+// opts: 用户针对每个字段的干预选择
+func DecodeHex(hexStr string, opts Options) (string, error) {
+	raw, err := ParseHex(hexStr)
+	if err != nil {
+		return "", err
+	}
+	return Decode(raw, opts)
+}
+
+// DecodeBase64 将base64文本表示的PB数据反序列化为json数据，文本格式见ParseBase64
+// b64: base64文本
+// opts: 用户针对每个字段的干预选择
+func DecodeBase64(b64 string, opts Options) (string, error) {
+	raw, err := ParseBase64(b64)
+	if err != nil {
+		return "", err
+	}
+	return Decode(raw, opts)
+}
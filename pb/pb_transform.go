@@ -0,0 +1,205 @@
+package pb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// maxTransformLen 转换表达式的最大长度
+	maxTransformLen = 128
+	// maxTransformDepth 转换表达式括号嵌套的最大深度
+	maxTransformDepth = 16
+)
+
+var (
+	// errInvalidTransform 转换表达式不合法
+	errInvalidTransform = errors.New("invalid transform expression")
+)
+
+// transformValue 对解析出的数值应用字段选择中的转换表达式
+// 如 {"5": {"type": "int32", "transform": "x/100"}}，配置了transform_raw时同时输出原始值
+// 非数值类型或者没有配置表达式时原样返回，结果为NaN或Inf时按照nf的non_finite_as输出
+func transformValue(opts Options, tag string, value interface{}, nf numberFormat) (interface{}, error) {
+	opt := opts.getFieldOption(tag)
+	expr, ok := opt[fieldTransformKey].(string)
+	if !ok {
+		return value, nil
+	}
+	x, ok := toFloat(value)
+	if !ok {
+		return value, nil
+	}
+	f, err := evalTransform(expr, x)
+	if err != nil {
+		return nil, err
+	}
+	res := nf.float(f, 64)
+	if raw, _ := opt[fieldTransformRawKey].(bool); raw {
+		return map[string]interface{}{
+			"value": res,
+			"raw":   value,
+		}, nil
+	}
+	return res, nil
+}
+
+// toFloat 将数值转换为float64，64位整数以字符串输出的也进行转换
+// 其它字符串不转换，如NaN和Inf输出的名称
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return float64(i), true
+		}
+		if u, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return float64(u), true
+		}
+	}
+	return 0, false
+}
+
+// evalTransform 计算转换表达式，x为字段的值
+// 只支持数字、x、+ - * /、一元负号和括号，不支持函数调用
+func evalTransform(expr string, x float64) (float64, error) {
+	if len(expr) > maxTransformLen {
+		return 0, fmt.Errorf("%w: too long", errInvalidTransform)
+	}
+	p := &transformParser{expr: expr, x: x}
+	value, err := p.parseExpr()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.expr) {
+		return 0, fmt.Errorf("%w: unexpected %q at %d", errInvalidTransform, p.expr[p.pos], p.pos)
+	}
+	return value, nil
+}
+
+// transformParser 转换表达式的递归下降解析器，解析的同时计算结果
+type transformParser struct {
+	expr  string
+	pos   int
+	depth int
+	x     float64
+}
+
+// skipSpace 跳过空白字符
+func (p *transformParser) skipSpace() {
+	for p.pos < len(p.expr) && (p.expr[p.pos] == ' ' || p.expr[p.pos] == HorizontalTab) {
+		p.pos++
+	}
+}
+
+// peek 返回下一个非空白字符，结束时返回0
+func (p *transformParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.expr) {
+		return 0
+	}
+	return p.expr[p.pos]
+}
+
+// parseExpr expr := term (('+'|'-') term)*
+func (p *transformParser) parseExpr() (float64, error) {
+	value, err := p.parseTerm()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return value, nil
+		}
+		p.pos++
+		rhs, err := p.parseTerm()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			value += rhs
+		} else {
+			value -= rhs
+		}
+	}
+}
+
+// parseTerm term := factor (('*'|'/') factor)*
+func (p *transformParser) parseTerm() (float64, error) {
+	value, err := p.parseFactor()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return value, nil
+		}
+		p.pos++
+		rhs, err := p.parseFactor()
+		if err != nil {
+			return 0, err
+		}
+		if op == '*' {
+			value *= rhs
+			continue
+		}
+		if rhs == 0 {
+			return 0, fmt.Errorf("%w: division by zero", errInvalidTransform)
+		}
+		value /= rhs
+	}
+}
+
+// parseFactor factor := number | 'x' | '(' expr ')' | '-' factor
+func (p *transformParser) parseFactor() (float64, error) {
+	c := p.peek()
+	switch {
+	case c == 'x':
+		p.pos++
+		return p.x, nil
+	case c == '-':
+		p.pos++
+		value, err := p.parseFactor()
+		return -value, err
+	case c == '(':
+		p.depth++
+		if p.depth > maxTransformDepth {
+			return 0, fmt.Errorf("%w: too deep", errInvalidTransform)
+		}
+		p.pos++
+		value, err := p.parseExpr()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("%w: missing ')'", errInvalidTransform)
+		}
+		p.pos++
+		p.depth--
+		return value, nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.expr) && (p.expr[p.pos] == '.' || (p.expr[p.pos] >= '0' && p.expr[p.pos] <= '9')) {
+			p.pos++
+		}
+		return strconv.ParseFloat(p.expr[start:p.pos], 64)
+	case c == 0:
+		return 0, fmt.Errorf("%w: unexpected end", errInvalidTransform)
+	}
+	return 0, fmt.Errorf("%w: unexpected %q at %d", errInvalidTransform, c, p.pos)
+}
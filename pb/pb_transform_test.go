@@ -0,0 +1,69 @@
+package pb
+
+import (
+	"math"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestTransformNonFinite(t *testing.T) {
+	double := func(f float64) []byte {
+		raw := protowire.AppendTag(nil, 1, protowire.Fixed64Type)
+		return protowire.AppendFixed64(raw, math.Float64bits(f))
+	}
+	tests := []struct {
+		name string
+		raw  []byte
+		opts Options
+		want string
+	}{
+		{
+			name: "nan input",
+			raw:  double(math.NaN()),
+			opts: Options{"1": map[string]interface{}{"type": "double", "transform": "x*2"}},
+			want: `{"1_double":"NaN"}`,
+		},
+		{
+			name: "overflow to infinity",
+			raw:  double(math.MaxFloat64),
+			opts: Options{"1": map[string]interface{}{"type": "double", "transform": "x*2"}},
+			want: `{"1_double":"Infinity"}`,
+		},
+		{
+			name: "negative infinity",
+			raw:  double(-math.MaxFloat64),
+			opts: Options{
+				"1":               map[string]interface{}{"type": "double", "transform": "x*2"},
+				OptionNonFiniteAs: nil,
+			},
+			want: `{"1_double":"-Infinity"}`,
+		},
+		{
+			name: "non_finite_as with raw",
+			raw:  double(math.MaxFloat64),
+			opts: Options{
+				"1":               map[string]interface{}{"type": "double", "transform": "x*2", "transform_raw": true},
+				OptionNonFiniteAs: "inf",
+			},
+			want: `{"1_double":{"raw":1.7976931348623157e+308,"value":"inf"}}`,
+		},
+		{
+			name: "64-bit integer string",
+			raw:  protowire.AppendFixed64(protowire.AppendTag(nil, 1, protowire.Fixed64Type), 250),
+			opts: Options{"1": map[string]interface{}{"type": "sfixed64", "transform": "x/100"}},
+			want: `{"1_sfixed64":2.5}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.raw, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
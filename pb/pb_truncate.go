@@ -0,0 +1,44 @@
+package pb
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// truncatedFormat 截断后追加的省略号和被省略的字节数
+const truncatedFormat = "…(+%d bytes)"
+
+// TruncateString 将字符串数据截断为最多max个字节，在UTF-8字符边界截断并追加省略的字节数
+// max小于等于0时不截断
+func TruncateString(data []byte, max int) string {
+	if max <= 0 || len(data) <= max {
+		return string(data)
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(data[cut]) {
+		cut--
+	}
+	return string(data[:cut]) + fmt.Sprintf(truncatedFormat, len(data)-cut)
+}
+
+// TruncateHex 将数据转换为十六进制字符串，最多输出max个字符并追加省略的字节数
+// max小于等于0时不截断
+func TruncateHex(data []byte, max int) string {
+	if max <= 0 || hex.EncodedLen(len(data)) <= max {
+		return hex.EncodeToString(data)
+	}
+	cut := max / 2
+	return hex.EncodeToString(data[:cut]) + fmt.Sprintf(truncatedFormat, len(data)-cut)
+}
+
+// TruncateBase64 将数据转换为base64字符串，最多输出约max个字符并追加省略的字节数
+// max小于等于0时不截断
+func TruncateBase64(data []byte, max int) string {
+	if max <= 0 || base64.StdEncoding.EncodedLen(len(data)) <= max {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	cut := max / 4 * 3
+	return base64.StdEncoding.EncodeToString(data[:cut]) + fmt.Sprintf(truncatedFormat, len(data)-cut)
+}
@@ -3,6 +3,7 @@ package pb
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 )
 
 // Type Proto序列化后的数据类型
@@ -49,8 +50,43 @@ const (
 	// Packed 字段设置了[packed=true]
 	Packed Type = 21
 
-	// MaxTagValue 支持的tag最大值
+	// 以下为pb之外的展示类型，取值需要避开Packed+X的范围
+
+	// Printable bytes类型，可打印字符原样展示，其它字符转义为\xNN
+	Printable Type = 50
+	// Flags varint类型，按位展示为标志位名称的列表
+	Flags Type = 51
+	// FieldMask google.protobuf.FieldMask类型，展示为逗号连接的路径
+	FieldMask Type = 52
+	// Enum 枚举类型，根据用户提供的映射展示为名称
+	Enum Type = 53
+	// TimestampS varint类型，秒级的unix时间戳，同时展示原始值和ISO-8601时间
+	TimestampS Type = 54
+	// TimestampMs varint类型，毫秒级的unix时间戳，同时展示原始值和ISO-8601时间
+	TimestampMs Type = 55
+	// Group proto2的group，以StartGroup和EndGroup包裹的嵌套字段
+	Group Type = 56
+	// Base64 bytes类型，以base64编码展示
+	Base64 Type = 57
+	// Map map字段，repeated的entry message展示为key到value的json对象
+	Map Type = 58
+	// Timestamp google.protobuf.Timestamp类型，展示为RFC3339时间
+	Timestamp Type = 59
+	// Duration google.protobuf.Duration类型，展示为Go的时长字符串，如 1.5s
+	Duration Type = 60
+	// Custom 使用custom_decoders中的自定义函数解析的字段
+	Custom Type = 61
+	// Any google.protobuf.Any类型，value解析为message，输出为 {"@type": "<type_url>", ...}
+	Any Type = 62
+
+	// MaxSafeInteger json(javascript)中可以精确表示的最大整数，2^53-1
+	MaxSafeInteger = 1<<53 - 1
+
+	// MaxTagValue 推测嵌套类型时支持的tag最大值，实际的message很少使用更大的tag，
+	// 限制tag可以减少将字符串和bytes误判为嵌套类型，指定了类型的字段使用max_tag
 	MaxTagValue = 9999
+	// DefaultMaxTag 默认支持的tag最大值，即protobuf规定的最大值2^29-1
+	DefaultMaxTag = 1<<29 - 1
 )
 
 var (
@@ -83,6 +119,19 @@ var (
 		Packed + Float:    "%d_packed.float",
 		Packed + SFixed32: "%d_packed.sfixed32",
 		Packed + SFixed64: "%d_packed.sfixed64",
+		Printable:         "%d_printable",
+		Flags:             "%d_flags",
+		FieldMask:         "%d_fieldmask",
+		Enum:              "%d_enum",
+		TimestampS:        "%d_timestamp_s",
+		TimestampMs:       "%d_timestamp_ms",
+		Group:             "%d_group",
+		Base64:            "%d_base64",
+		Map:               "%d_map",
+		Timestamp:         "%d_timestamp",
+		Duration:          "%d_duration",
+		Custom:            "%d_custom",
+		Any:               "%d_any",
 	}
 
 	// namesToType 名称和对应类型的映射
@@ -127,6 +176,18 @@ var (
 		"floats":           Float,
 		"sfixed32s":        SFixed32,
 		"sfixed64s":        SFixed64,
+		"printable":        Printable,
+		"flags":            Flags,
+		"fieldmask":        FieldMask,
+		"enum":             Enum,
+		"timestamp_s":      TimestampS,
+		"timestamp_ms":     TimestampMs,
+		"group":            Group,
+		"base64":           Base64,
+		"map":              Map,
+		"timestamp":        Timestamp,
+		"duration":         Duration,
+		"any":              Any,
 	}
 
 	// varintNamesToType varint类型数据
@@ -137,6 +198,11 @@ var (
 		"uint":   UInt,
 		"sint":   SInt,
 		"bool":   Bool,
+		"flags":  Flags,
+		"enum":   Enum,
+
+		"timestamp_s":  TimestampS,
+		"timestamp_ms": TimestampMs,
 	}
 
 	// fixed32NamesToType fixed32类型数据
@@ -155,9 +221,15 @@ var (
 
 	// simpleBytesNamesToType 简单bytes类型数据
 	simpleBytesNamesToType = map[string]Type{
-		"bytes":   Bytes,
-		"string":  String,
-		"message": Message,
+		"bytes":     Bytes,
+		"string":    String,
+		"message":   Message,
+		"printable": Printable,
+		"fieldmask": FieldMask,
+		"base64":    Base64,
+		"timestamp": Timestamp,
+		"duration":  Duration,
+		"any":       Any,
 	}
 
 	// listNamesToType unpacked repeated类型
@@ -194,6 +266,145 @@ var (
 	}
 )
 
+// 全局选择的key，与tag的key不会冲突
+const (
+	// OptionSkipUnknownWire 遇到未知的wire type时跳过并尝试继续解析，有损，默认关闭
+	OptionSkipUnknownWire = "skip_unknown_wire"
+	// OptionSpeculativeMaxBytes 未指定类型的bytes字段超过该长度时不再推测为嵌套类型，0表示总是推测
+	OptionSpeculativeMaxBytes = "speculative_max_bytes"
+	// OptionOnly 只输出列表中的tag，如 [1, 2, 5]，其它字段仍然会被读取但不输出
+	// 只对当前层级生效，嵌套类型通过嵌套的选择配置
+	OptionOnly = "only"
+	// OptionEnumBoth 为true时所有枚举字段都输出为 {"name": "ACTIVE", "number": 1}
+	OptionEnumBoth = "enum_both"
+	// OptionPluralSuffix repeated字段的key的后缀，默认为s，为空时不加后缀，也可以是 _list 等
+	OptionPluralSuffix = "plural_suffix"
+	// OptionNoPlural 为true时repeated字段的key不加后缀，与单个值的key相同，优先于plural_suffix
+	OptionNoPlural = "no_plural"
+	// OptionMaxFields 所有层级的字段总数的最大值，超出时返回ErrBudgetExceeded，默认为DefaultMaxFields，0表示不限制
+	OptionMaxFields = "max_fields"
+	// OptionMaxTag 支持的tag最大值，超出时返回错误，默认为DefaultMaxTag，0表示使用默认值
+	// 推测嵌套类型时tag不超过MaxTagValue，即使max_tag更大，包含更大tag的嵌套message需要指定类型为message
+	OptionMaxTag = "max_tag"
+	// OptionReportGuesses 为true时DecodeWithDiagnostics返回没有指定类型的bytes字段推测的类型及其可信度
+	OptionReportGuesses = "report_guesses"
+	// OptionMaxOutputBytes 估算的输出最大字节数，超出时返回ErrBudgetExceeded，默认为DefaultMaxOutputBytes，0表示不限制
+	OptionMaxOutputBytes = "max_output_bytes"
+	// OptionRedactStyle 字段选择中redact为true时的脱敏方式，可选 fixed(默认)、length、hash
+	OptionRedactStyle = "redact_style"
+	// OptionExtensionRanges proto2扩展字段的tag范围，如 [[100, 199]]，范围内的字段输出到__extensions中
+	// 只对当前层级生效，嵌套类型通过嵌套的选择配置
+	OptionExtensionRanges = "extension_ranges"
+	// OptionMaxStringLen 字符串和十六进制的bytes输出的最大长度，超出时截断并标明省略的字节数，0表示不限制
+	OptionMaxStringLen = "max_string_len"
+	// OptionConsistentSchema 为true时DecodeDelimitedStream中所有消息的字段使用一致的类型
+	OptionConsistentSchema = "consistent_schema"
+	// OptionLenientVarint 为true时超过64位的varint截断为64位后继续解析，默认返回ErrOverlongVarint
+	OptionLenientVarint = "lenient_varint"
+	// OptionResyncMaxScan DecodeResync最多跳过的字节数，默认为256
+	OptionResyncMaxScan = "resync_max_scan"
+	// OptionAllNumbersAsStrings 为true时所有的数值都输出为字符串，避免json解析器的精度丢失
+	OptionAllNumbersAsStrings = "all_numbers_as_strings"
+	// OptionBytesEncoding 没有指定展示方式的bytes数据的编码，hex(默认)或者base64
+	// base64编码的字段的key中类型为base64，如 5_base64，Encode可以据此还原
+	OptionBytesEncoding = "bytes_encoding"
+	// BytesEncodingBase64 bytes数据使用base64编码
+	BytesEncodingBase64 = "base64"
+	// OptionStructuredKeys 为true时字段输出为 {"field_1": {"tag": 1, "type": "int32", "value": 5}}，
+	// repeated字段为这种对象的数组，不再修复TagType名称
+	OptionStructuredKeys = "structured_keys"
+	// OptionVarintInterpretations 为true时未指定类型的varint输出为各种可能的解释，
+	// 如 {"3_varint": {"as_uint": 300, "as_sint": 150, "as_int32": 300, "as_int64": 300}}，值为0或1时还有as_bool
+	OptionVarintInterpretations = "varint_interpretations"
+	// OptionBestEffort 为true时数据中间出现错误(如结尾有多余的数据)不再返回错误，
+	// 而是停止解析并返回已经解析的字段，错误信息和偏移记录在ErrorKey中
+	OptionBestEffort = "best_effort"
+	// OptionStrict 为true时没有指定类型的bytes字段不再推测为message或string，按照bytes_encoding输出为bytes
+	// 影响readBytes的默认分支(包括map的key和value、合并的bytes字段以及判别字段没有对应选择时的解析)，
+	// 指定了类型的字段和varint、fixed32、fixed64的解析不受影响
+	OptionStrict = "strict"
+	// OptionFloatPrecision float和double保留的有效数字位数，如3时0.123456输出为0.123，为0时保持原值
+	// float按照32位的精度输出，如0.1不会输出为0.10000000149011612
+	OptionFloatPrecision = "float_precision"
+	// OptionNonFiniteAs float和double为NaN或Inf时输出的值，如 0 或者 "-"
+	// 没有配置或者为null时输出为"NaN"、"Infinity"、"-Infinity"，与proto3的json映射一致
+	OptionNonFiniteAs = "non_finite_as"
+	// OptionEmptyAs 没有指定类型的空bytes字段输出的类型，默认为message，即输出为 {"1_message": {}}
+	// 为string时输出为 {"1_string": ""}，为bytes时输出为 {"1_bytes": ""}，指定了类型的字段不受影响
+	OptionEmptyAs = "empty_as"
+	// EmptyAsMessage 空数据输出为message
+	EmptyAsMessage = "message"
+	// EmptyAsString 空数据输出为string
+	EmptyAsString = "string"
+	// EmptyAsBytes 空数据输出为bytes
+	EmptyAsBytes = "bytes"
+	// OptionInt64AsNumber 为true时64位整数(int64、uint、sint、varint、fixed64、sfixed64及其packed类型)
+	// 在[-MaxSafeInteger, MaxSafeInteger]范围内输出为数值，超出范围输出为字符串，jce的int64同样使用该选择
+	// 默认fixed64和sfixed64输出为字符串，其它类型输出为数值
+	OptionInt64AsNumber = "int64_as_number"
+	// OptionOrdered 为true时Decode按照字段在数据中第一次出现的顺序输出，嵌套的message同样保持顺序
+	// structured_keys为true时不生效
+	OptionOrdered = "ordered"
+	// OptionKeyFormatter 输出的key的格式，值为KeyFormatter，只能在代码中设置，如 PaddedKeyFormatter(4)
+	// 在修复TagType名称之后使用，typeName为修复后的名称，如 strings，jce同样使用该选择
+	OptionKeyFormatter = "key_formatter"
+	// OptionCustomDecoders tag和自定义解析函数的映射，值为map[string]CustomDecoder，只能在代码中设置
+	// 只对当前层级的varint和bytes字段生效，优先于字段选择中的类型
+	OptionCustomDecoders = "custom_decoders"
+	// OptionMaxDepth 允许的最大嵌套深度，默认为DefaultMaxDepth，超出时返回ErrTooDeep，jce同样使用该选择
+	OptionMaxDepth = "max_depth"
+
+	// defaultPluralSuffix repeated字段的key的默认后缀
+	defaultPluralSuffix = "s"
+)
+
+// isPacked 判断是否是packed=true的repeated类型
+func isPacked(typ Type) bool {
+	return typ > Packed && typ <= Packed+SFixed64
+}
+
+// 字段选择对象中使用的key，字段选择对象的写法如 {"5": {"type": "message", "key_by": "1"}}
+const (
+	// fieldTypeKey 字段的类型
+	fieldTypeKey = "type"
+	// fieldWKTKey 字段的well-known type，如 "fieldmask"，没有配置type时作为字段的类型
+	fieldWKTKey = "wkt"
+	// fieldEnumKey 枚举值和名称的映射，如 {"0": "UNKNOWN", "1": "ACTIVE"}，没有配置type时字段为枚举类型
+	fieldEnumKey = "__enum"
+	// fieldEnumBothKey 为true时枚举同时输出名称和数值
+	fieldEnumBothKey = "enum_both"
+	// fieldOptionsKey 嵌套类型的选择
+	fieldOptionsKey = "options"
+	// fieldKeyByKey repeated message以子字段的值作为key输出为对象
+	fieldKeyByKey = "key_by"
+	// fieldBitsKey flags类型中位和名称的映射，如 {"0": "READ", "1": "WRITE"}
+	fieldBitsKey = "bits"
+	// fieldTransformKey 数值类型的转换表达式，如 "x/100"
+	fieldTransformKey = "transform"
+	// fieldTransformRawKey 配置了转换表达式时是否同时输出原始值
+	fieldTransformRawKey = "transform_raw"
+	// fieldPluralKey 为false时repeated字段的key不加s
+	fieldPluralKey = "plural"
+	// fieldPluralNameKey repeated字段的key使用的名称，如 "values" 时key为 tag_values
+	fieldPluralNameKey = "plural_name"
+	// fieldPrecisionKey float和double保留的有效数字位数，优先于全局的float_precision
+	fieldPrecisionKey = "precision"
+	// fieldCoalesceKey 为true时同一tag的多个bytes字段拼接为一个值输出，用于分块传输的数据
+	fieldCoalesceKey = "coalesce"
+	// fieldDiscriminatorKey 判别字段的tag，bytes字段根据判别字段的值选择cases中的选择解析
+	fieldDiscriminatorKey = "discriminator"
+	// fieldCasesKey 判别字段的值和嵌套选择的映射
+	fieldCasesKey = "cases"
+	// fieldStripInnerLengthKey 为true时去掉bytes字段数据开头多余的varint长度
+	fieldStripInnerLengthKey = "strip_inner_length"
+	// fieldCountPrefixedKey 为true时packed类型的数据开头为元素个数的varint，如 {"5": {"type": "packed.int32s", "count_prefixed": true}}
+	fieldCountPrefixedKey = "count_prefixed"
+	// fieldFramingKey bytes字段自定义封装的描述，解析前去掉封装，如 {"skip": 2, "length": "varint", "trailer": 4}
+	fieldFramingKey = "framing"
+	// fieldRedactKey 为true时输出脱敏后的值，也可以直接指定脱敏方式，如 "hash"
+	fieldRedactKey = "redact"
+)
+
 // Options 用户对PB数据解析的干预选择
 type Options map[string]interface{}
 
@@ -219,6 +430,31 @@ func (o Options) GetOptionsByTag(tag string) Options {
 	if opts, ok := o[GetOptionsKey(tag)].(Options); ok {
 		return opts
 	}
+	// 字段选择对象中的嵌套选择
+	if opts, ok := o.getFieldOption(tag)[fieldOptionsKey].(map[string]interface{}); ok {
+		return Options(opts)
+	}
+	return nil
+}
+
+// getFieldOption 获取tag对应的字段选择对象，只有包含type、wkt或__enum的对象才是字段选择对象，没有则返回nil
+func (o Options) getFieldOption(tag string) map[string]interface{} {
+	if o == nil {
+		return nil
+	}
+	opt, ok := o[tag].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if _, ok := opt[fieldTypeKey].(string); ok {
+		return opt
+	}
+	if _, ok := opt[fieldWKTKey].(string); ok {
+		return opt
+	}
+	if _, ok := opt[fieldEnumKey].(map[string]interface{}); ok {
+		return opt
+	}
 	return nil
 }
 
@@ -233,7 +469,22 @@ func (o Options) GetTypeByTag(tag string) Type {
 		return Unkown
 	}
 
-	// 先判断是否是结构体类型
+	// 先判断是否是字段选择对象
+	if opt := o.getFieldOption(tag); opt != nil {
+		name, ok := opt[fieldTypeKey].(string)
+		if !ok {
+			name, _ = opt[fieldWKTKey].(string)
+		}
+		if typ, ok := namesToType[name]; ok {
+			return typ
+		}
+		if _, ok := opt[fieldEnumKey]; ok {
+			return Enum
+		}
+		return Unkown
+	}
+
+	// 再判断是否是结构体类型
 	if _, ok := o[tag].(map[string]interface{}); ok {
 		return Message
 	}
@@ -246,3 +497,106 @@ func (o Options) GetTypeByTag(tag string) Type {
 	}
 	return Unkown
 }
+
+// isRepeated 判断tag是否选择了unpacked repeated类型，如 {"5": "int32s"}，只出现一次时同样输出为数组
+func (o Options) isRepeated(tag string) bool {
+	name, ok := o[tag].(string)
+	if !ok {
+		name, _ = o.getFieldOption(tag)[fieldTypeKey].(string)
+	}
+	_, ok = listNamesToType[name]
+	return ok
+}
+
+// getBool 获取bool类型的全局选择，没有配置则返回false
+func (o Options) getBool(key string) bool {
+	if o == nil {
+		return false
+	}
+	value, _ := o[key].(bool)
+	return value
+}
+
+// getInt 获取整数类型的全局选择，没有配置则返回def
+// 通过json解析得到的数字为float64，也兼容直接传入的int
+func (o Options) getInt(key string, def int) int {
+	if o == nil {
+		return def
+	}
+	switch value := o[key].(type) {
+	case float64:
+		return int(value)
+	case int:
+		return value
+	}
+	return def
+}
+
+// allowTag 判断tag是否需要输出，没有配置only时都需要输出
+func (o Options) allowTag(tag uint64) bool {
+	if o == nil {
+		return true
+	}
+	only, ok := o[OptionOnly].([]interface{})
+	if !ok {
+		return true
+	}
+	for _, v := range only {
+		switch t := v.(type) {
+		case float64:
+			if uint64(t) == tag {
+				return true
+			}
+		case int:
+			if uint64(t) == tag {
+				return true
+			}
+		case string:
+			if t == strconv.FormatUint(tag, 10) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isCoalesced 判断tag对应的bytes字段是否需要合并
+func (o Options) isCoalesced(tag uint64) bool {
+	coalesce, _ := o.getFieldOption(strconv.FormatUint(tag, 10))[fieldCoalesceKey].(bool)
+	return coalesce
+}
+
+// levelOnlyOptions 只对当前层级生效的选择
+var levelOnlyOptions = []string{OptionOnly, OptionExtensionRanges, OptionCustomDecoders}
+
+// inherited 返回推测的嵌套类型使用的选择，去掉只对当前层级生效的选择
+func (o Options) inherited() Options {
+	found := false
+	for _, key := range levelOnlyOptions {
+		if _, ok := o[key]; ok {
+			found = true
+		}
+	}
+	if !found {
+		return o
+	}
+	opts := make(Options, len(o))
+	for k, v := range o {
+		opts[k] = v
+	}
+	for _, key := range levelOnlyOptions {
+		delete(opts, key)
+	}
+	return opts
+}
+
+// KeyFormatter 获取全局选择key_formatter设置的key格式，没有设置则返回nil
+func (o Options) KeyFormatter() KeyFormatter {
+	switch f := o[OptionKeyFormatter].(type) {
+	case KeyFormatter:
+		return f
+	case func(uint64, string) string:
+		return f
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package pb
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// keyTypes 结果的key中的类型名称和类型的映射，如 int32 对应Int32
+var keyTypes = func() map[string]Type {
+	types := make(map[string]Type, len(typeNamesFormat))
+	for typ := range typeNamesFormat {
+		types[TypeName(typ)] = typ
+	}
+	return types
+}()
+
+// TypedField 类型化的解析结果，调用方不需要再从 1_int32 这样的key中解析tag和类型
+type TypedField struct {
+	// Tag 字段的tag，Name不为空时为0
+	Tag uint64 `json:"tag,omitempty"`
+	// Type 字段的类型，与Decode输出的key中的类型一致，json中输出为类型名称，如 int32
+	Type Type `json:"type"`
+	// Name 不是 tag_type 格式的key，如Any的@type，普通字段为空
+	Name string `json:"name,omitempty"`
+	// Value 字段的值，message和repeated字段没有值
+	// map字段的值为map[string]interface{}，其中message类型的值为[]TypedField
+	Value interface{} `json:"value,omitempty"`
+	// Children message中的字段
+	Children []TypedField `json:"children,omitempty"`
+	// Items repeated字段的元素，元素的Tag和Type与字段相同
+	Items []TypedField `json:"items,omitempty"`
+}
+
+// MarshalJSON 输出json时类型为名称，如 int32，与Decode输出的key中的类型名称一致
+func (f TypedField) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Tag      uint64       `json:"tag,omitempty"`
+		Type     string       `json:"type"`
+		Name     string       `json:"name,omitempty"`
+		Value    interface{}  `json:"value,omitempty"`
+		Children []TypedField `json:"children,omitempty"`
+		Items    []TypedField `json:"items,omitempty"`
+	}{f.Tag, TypeName(f.Type), f.Name, f.Value, f.Children, f.Items})
+}
+
+// DecodeFields 将PB二进制数据反序列化为类型化的字段树，字段按照tag排序
+// 扩展字段与普通字段一起输出，选择了best_effort时的错误信息不输出
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+func DecodeFields(raw []byte, opts Options) ([]TypedField, error) {
+	res, err := decode(newDecodeState(raw, opts), raw, opts)
+	if err != nil {
+		return nil, err
+	}
+	return fieldsOf(res), nil
+}
+
+// fieldsOf 将message的解析结果转换为字段列表，需要在修复TagType名称之前调用
+func fieldsOf(res JSONResult) []TypedField {
+	fields := make([]TypedField, 0, len(res))
+	for k, v := range res {
+		switch k {
+		case ExtensionsKey:
+			if ext, ok := v.(JSONResult); ok {
+				fields = append(fields, fieldsOf(ext)...)
+			}
+			continue
+		case ErrorKey:
+			continue
+		}
+		idx := strings.IndexByte(k, '_')
+		if idx <= 0 {
+			fields = append(fields, TypedField{Name: k, Value: typedValue(v)})
+			continue
+		}
+		fields = append(fields, fieldOf(keyTag(k), keyTypes[k[idx+1:]], v))
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].Tag != fields[j].Tag {
+			return fields[i].Tag < fields[j].Tag
+		}
+		if fields[i].Type != fields[j].Type {
+			return fields[i].Type < fields[j].Type
+		}
+		return fields[i].Name < fields[j].Name
+	})
+	return fields
+}
+
+// fieldOf 将一个字段的值转换为TypedField，数组转换为Items
+func fieldOf(tag uint64, typ Type, v interface{}) TypedField {
+	field := TypedField{Tag: tag, Type: typ}
+	switch value := v.(type) {
+	case JSONResult:
+		field.Children = fieldsOf(value)
+	case []interface{}:
+		field.Items = make([]TypedField, 0, len(value))
+		for _, item := range value {
+			field.Items = append(field.Items, fieldOf(tag, typ, item))
+		}
+	default:
+		field.Value = typedValue(v)
+	}
+	return field
+}
+
+// typedValue 转换值中嵌套的message，map字段以及key_by生成的对象中的message转换为[]TypedField
+func typedValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case JSONResult:
+		return fieldsOf(value)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			out[k] = typedValue(item)
+		}
+		return out
+	case []interface{}:
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			items[i] = typedValue(item)
+		}
+		return items
+	}
+	return v
+}
@@ -0,0 +1,30 @@
+package pb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestTypedFieldMarshalJSON(t *testing.T) {
+	var sub []byte
+	sub = protowire.AppendVarint(protowire.AppendTag(sub, 1, protowire.VarintType), 7)
+	sub = protowire.AppendVarint(protowire.AppendTag(sub, 1, protowire.VarintType), 8)
+	raw := protowire.AppendBytes(protowire.AppendTag(nil, 2, protowire.BytesType), sub)
+	fields, err := DecodeFields(raw, Options{"2": "message", "2options": map[string]interface{}{"1": "int32"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields[0].Type != Message {
+		t.Errorf("got type %d, want %d", fields[0].Type, Message)
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"tag":2,"type":"message","children":[{"tag":1,"type":"int32","items":[{"tag":1,"type":"int32","value":7},{"tag":1,"type":"int32","value":8}]}]}]`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,44 @@
+package pb
+
+import (
+	"errors"
+)
+
+const (
+	// maxVarintLen 64位varint的最大字节数
+	maxVarintLen = 10
+)
+
+var (
+	// ErrOverlongVarint varint超过了64位，通常来自有问题的编码器
+	ErrOverlongVarint = errors.New("overlong varint")
+)
+
+// isOverlongVarint 判断数据开头的varint是否超过了64位，数据不完整时返回false
+// 前9个字节都有后续标志时，第10个字节只能为0或1，否则超过64位
+func isOverlongVarint(raw []byte) bool {
+	if len(raw) < maxVarintLen {
+		return false
+	}
+	for _, b := range raw[:maxVarintLen-1] {
+		if b < 0x80 {
+			return false
+		}
+	}
+	return raw[maxVarintLen-1] > 1
+}
+
+// consumeLenientVarint 读取任意长度的varint，超过64位的部分丢弃，返回值和读取的字节数
+// 没有结束的字节时返回-1
+func consumeLenientVarint(raw []byte) (uint64, int) {
+	var v uint64
+	for i, b := range raw {
+		if shift := uint(7 * i); shift < 64 {
+			v |= uint64(b&0x7f) << shift
+		}
+		if b < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, -1
+}
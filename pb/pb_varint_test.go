@@ -0,0 +1,36 @@
+package pb
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestDecodeOverlongVarint(t *testing.T) {
+	for _, n := range []int{11, 12} {
+		// n字节的varint，最后一个字节没有后续标志
+		raw := protowire.AppendTag(nil, 1, protowire.VarintType)
+		raw = append(raw, bytes.Repeat([]byte{0xff}, n-1)...)
+		raw = append(raw, 0x01)
+		raw = protowire.AppendVarint(protowire.AppendTag(raw, 2, protowire.VarintType), 5)
+
+		_, err := Decode(raw, nil)
+		if !errors.Is(err, ErrOverlongVarint) {
+			t.Fatalf("%d bytes: got %v, want %v", n, err, ErrOverlongVarint)
+		}
+		if !strings.Contains(err.Error(), "at offset 1 for field 1") {
+			t.Errorf("%d bytes: got %v, want offset and field", n, err)
+		}
+
+		got, err := Decode(raw, Options{OptionLenientVarint: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"1_varint":18446744073709551615,"2_varint":5}`; got != want {
+			t.Errorf("%d bytes lenient: got %s, want %s", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package pb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	// errRoundTripMismatch 解析结果重新序列化后与原始数据不一致
+	errRoundTripMismatch = errors.New("round trip mismatch")
+)
+
+// DecodeVerify 将PB二进制数据反序列化为json数据，并将结果通过EncodeWithOptions重新序列化后与原始数据比较
+// 不同tag之间的顺序、packed和非packed的编码方式、嵌套message中字段的顺序、map中entry的顺序的差异不影响比较
+// custom_decoders解析的字段无法还原，不参与比较
+// 不一致时返回json数据以及DecodeError，Path为第一个不一致的字段的tag路径，Offset为其在原始数据中的偏移
+// raw: 要进行反序列化的PB数据
+// opts: 用户针对每个字段的干预选择
+func DecodeVerify(raw []byte, opts Options) (string, error) {
+	js, err := Decode(raw, opts)
+	if err != nil {
+		return "", err
+	}
+	dec := json.NewDecoder(strings.NewReader(js))
+	dec.UseNumber()
+	var msg map[string]interface{}
+	if err = dec.Decode(&msg); err != nil {
+		return js, err
+	}
+	opaque := stripOpaque(msg)
+	encoded, err := encodeMessage(newEncodeState(opts), nil, msg, opts)
+	if err != nil {
+		return js, fmt.Errorf("%w: re-encode: %v", errRoundTripMismatch, err)
+	}
+	st := &decodeState{rootCap: cap(raw)}
+	if err = compareMessage(st, raw, encoded, opaque); err != nil {
+		return js, err
+	}
+	return js, nil
+}
+
+// opaqueFields 无法重新序列化的字段，比较时跳过
+type opaqueFields struct {
+	// tags 当前层级跳过的tag
+	tags map[uint64]bool
+	// nested 嵌套message中跳过的字段
+	nested map[uint64]*opaqueFields
+}
+
+// stripOpaque 删除解析结果中无法重新序列化的字段，返回被删除的字段，没有时返回nil
+func stripOpaque(msg map[string]interface{}) *opaqueFields {
+	var opaque *opaqueFields
+	for k, v := range msg {
+		if ext, ok := v.(map[string]interface{}); ok && k == ExtensionsKey {
+			// 扩展字段与当前层级的字段一起序列化
+			opaque = opaque.merge(stripOpaque(ext))
+			continue
+		}
+		// custom不是可以配置的类型，parseFieldKey无法识别
+		if tag := keyTag(k); k == fieldKey(Custom, tag) {
+			delete(msg, k)
+			opaque = opaque.merge(&opaqueFields{tags: map[uint64]bool{tag: true}})
+			continue
+		}
+		tag, typ, err := parseFieldKey(k)
+		if err != nil {
+			continue
+		}
+		switch typ {
+		case Message, Group, Any:
+			items, ok := v.([]interface{})
+			if !ok {
+				items = []interface{}{v}
+			}
+			for _, item := range items {
+				if m, ok := item.(map[string]interface{}); ok {
+					if sub := stripOpaque(m); sub != nil {
+						opaque = opaque.merge(&opaqueFields{nested: map[uint64]*opaqueFields{uint64(tag): sub}})
+					}
+				}
+			}
+		}
+	}
+	return opaque
+}
+
+// merge 合并两组跳过的字段
+func (o *opaqueFields) merge(other *opaqueFields) *opaqueFields {
+	if other == nil {
+		return o
+	}
+	if o == nil {
+		return other
+	}
+	for tag := range other.tags {
+		if o.tags == nil {
+			o.tags = map[uint64]bool{}
+		}
+		o.tags[tag] = true
+	}
+	for tag, sub := range other.nested {
+		if o.nested == nil {
+			o.nested = map[uint64]*opaqueFields{}
+		}
+		o.nested[tag] = o.nested[tag].merge(sub)
+	}
+	return o
+}
+
+// skip 判断当前层级的tag是否跳过
+func (o *opaqueFields) skip(tag uint64) bool {
+	return o != nil && o.tags[tag]
+}
+
+// sub 获取嵌套message中跳过的字段
+func (o *opaqueFields) sub(tag uint64) *opaqueFields {
+	if o == nil {
+		return nil
+	}
+	return o.nested[tag]
+}
+
+// wireValue 一个字段的值，varint和fixed类型为数值，bytes和group类型为数据
+type wireValue struct {
+	typ    protowire.Type
+	number uint64
+	data   []byte
+	// raw 值在原始数据中的位置，用于计算偏移
+	raw []byte
+}
+
+// wireFields 按tag分组读取message的所有字段，同一tag的值保持出现的顺序
+func wireFields(raw []byte) (map[uint64][]wireValue, error) {
+	fields := map[uint64][]wireValue{}
+	for len(raw) > 0 {
+		num, typ, n := protowire.ConsumeTag(raw)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		value := wireValue{typ: typ, raw: raw}
+		raw = raw[n:]
+		switch typ {
+		case protowire.VarintType:
+			value.number, n = protowire.ConsumeVarint(raw)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(raw)
+			value.number = uint64(v)
+		case protowire.Fixed64Type:
+			value.number, n = protowire.ConsumeFixed64(raw)
+		case protowire.BytesType:
+			value.data, n = protowire.ConsumeBytes(raw)
+		case protowire.StartGroupType:
+			value.data, n = protowire.ConsumeGroup(num, raw)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, raw)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		raw = raw[n:]
+		fields[uint64(num)] = append(fields[uint64(num)], value)
+	}
+	return fields, nil
+}
+
+// unpackValues 对方为数值类型时将packed编码的bytes值展开为数值，展开失败时保持不变
+func unpackValues(values []wireValue, scalar protowire.Type) []wireValue {
+	unpacked := make([]wireValue, 0, len(values))
+	for _, v := range values {
+		if v.typ != protowire.BytesType {
+			unpacked = append(unpacked, v)
+			continue
+		}
+		items, ok := unpackScalars(v, scalar)
+		if !ok {
+			unpacked = append(unpacked, v)
+			continue
+		}
+		unpacked = append(unpacked, items...)
+	}
+	return unpacked
+}
+
+// unpackScalars 将packed编码的数据按照数值类型展开
+func unpackScalars(v wireValue, scalar protowire.Type) ([]wireValue, bool) {
+	var items []wireValue
+	data := v.data
+	for len(data) > 0 {
+		item := wireValue{typ: scalar, raw: v.raw}
+		var n int
+		switch scalar {
+		case protowire.VarintType:
+			item.number, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed32Type:
+			var x uint32
+			x, n = protowire.ConsumeFixed32(data)
+			item.number = uint64(x)
+		case protowire.Fixed64Type:
+			item.number, n = protowire.ConsumeFixed64(data)
+		default:
+			return nil, false
+		}
+		if n < 0 {
+			return nil, false
+		}
+		data = data[n:]
+		items = append(items, item)
+	}
+	return items, true
+}
+
+// scalarType 获取值中的数值类型，没有数值类型时返回bytes类型
+func scalarType(values []wireValue) protowire.Type {
+	for _, v := range values {
+		if v.typ == protowire.VarintType || v.typ == protowire.Fixed32Type || v.typ == protowire.Fixed64Type {
+			return v.typ
+		}
+	}
+	return protowire.BytesType
+}
+
+// compareMessage 比较原始的message和重新序列化的message，返回第一个不一致的字段的DecodeError
+func compareMessage(st *decodeState, raw, encoded []byte, opaque *opaqueFields) error {
+	original, err := wireFields(raw)
+	if err != nil {
+		return &DecodeError{Offset: st.offset(raw), Err: fmt.Errorf("%w: %v", errRoundTripMismatch, err)}
+	}
+	reencoded, err := wireFields(encoded)
+	if err != nil {
+		return &DecodeError{Offset: st.offset(raw), Err: fmt.Errorf("%w: re-encoded: %v", errRoundTripMismatch, err)}
+	}
+	tags := make([]uint64, 0, len(original))
+	for tag := range original {
+		tags = append(tags, tag)
+	}
+	for tag := range reencoded {
+		if _, ok := original[tag]; !ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	for _, tag := range tags {
+		if opaque.skip(tag) {
+			continue
+		}
+		if err := compareField(st, raw, original[tag], reencoded[tag], opaque.sub(tag)); err != nil {
+			return wrapFieldError(tag, st.offset(raw), err)
+		}
+	}
+	return nil
+}
+
+// compareField 比较同一tag的所有值，packed和非packed的编码方式视为一致
+// bytes和group类型的值与位置不同的值一致时也视为一致，如map中entry的顺序
+func compareField(st *decodeState, raw []byte, original, reencoded []wireValue, opaque *opaqueFields) error {
+	if scalar := scalarType(reencoded); scalar != protowire.BytesType {
+		original = unpackValues(original, scalar)
+	}
+	if scalar := scalarType(original); scalar != protowire.BytesType {
+		reencoded = unpackValues(reencoded, scalar)
+	}
+	if len(original) != len(reencoded) {
+		offset := st.offset(raw)
+		if len(original) > 0 {
+			offset = st.offset(original[0].raw)
+		}
+		return &DecodeError{Offset: offset, Err: fmt.Errorf("%w: %d values, re-encoded %d",
+			errRoundTripMismatch, len(original), len(reencoded))}
+	}
+	for i, v := range original {
+		r := reencoded[i]
+		if v.typ != r.typ {
+			return &DecodeError{Offset: st.offset(v.raw), Err: fmt.Errorf("%w: wire type %d, re-encoded %d",
+				errRoundTripMismatch, v.typ, r.typ)}
+		}
+		if v.typ != protowire.BytesType && v.typ != protowire.StartGroupType {
+			if v.number != r.number {
+				return &DecodeError{Offset: st.offset(v.raw), Err: fmt.Errorf("%w: value %d, re-encoded %d",
+					errRoundTripMismatch, v.number, r.number)}
+			}
+			continue
+		}
+		err := compareData(st, v, r, opaque)
+		if err == nil {
+			continue
+		}
+		// 查找后面位置一致的值，找到时交换位置
+		found := false
+		for j := i + 1; j < len(reencoded); j++ {
+			if reencoded[j].typ == v.typ && compareData(st, v, reencoded[j], opaque) == nil {
+				reencoded[i], reencoded[j] = reencoded[j], reencoded[i]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareData 比较bytes和group类型的值，嵌套message中字段的顺序可能不同，作为message比较
+func compareData(st *decodeState, v, r wireValue, opaque *opaqueFields) error {
+	if opaque == nil && bytes.Equal(v.data, r.data) {
+		return nil
+	}
+	if _, err := wireFields(v.data); err == nil && len(v.data) > 0 {
+		return compareMessage(st, v.data, r.data, opaque)
+	}
+	if bytes.Equal(v.data, r.data) {
+		return nil
+	}
+	return &DecodeError{Offset: st.offset(v.raw), Err: fmt.Errorf("%w: %d bytes, re-encoded %d bytes",
+		errRoundTripMismatch, len(v.data), len(r.data))}
+}
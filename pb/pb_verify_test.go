@@ -0,0 +1,77 @@
+package pb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestDecodeVerify(t *testing.T) {
+	var sub []byte
+	sub = protowire.AppendTag(sub, 2, protowire.VarintType)
+	sub = protowire.AppendVarint(sub, 7)
+	sub = protowire.AppendTag(sub, 1, protowire.Fixed32Type)
+	sub = protowire.AppendFixed32(sub, 0x3f800000)
+
+	// 字段顺序与Encode的输出不同
+	var raw []byte
+	raw = protowire.AppendTag(raw, 3, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, sub)
+	raw = protowire.AppendTag(raw, 1, protowire.VarintType)
+	raw = protowire.AppendVarint(raw, 5)
+	// map的entry不按照key的顺序出现
+	for _, key := range []string{"b", "a"} {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = protowire.AppendTag(entry, 2, protowire.VarintType)
+		entry = protowire.AppendVarint(entry, 1)
+		raw = protowire.AppendTag(raw, 4, protowire.BytesType)
+		raw = protowire.AppendBytes(raw, entry)
+	}
+	raw = protowire.AppendTag(raw, 5, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, anyMessage("type.googleapis.com/foo.Bar", []byte{0xff}))
+	raw = protowire.AppendTag(raw, 6, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, appendSecondsNanos(nil, 1700000000, 0))
+	raw = protowire.AppendTag(raw, 7, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, []byte("opaque"))
+
+	opts := Options{
+		"3options": map[string]interface{}{"1": "float"},
+		"4":        "map",
+		"5":        "any",
+		"6":        "timestamp",
+		OptionCustomDecoders: map[string]CustomDecoder{
+			"7": func(raw []byte) (interface{}, error) { return len(raw), nil },
+		},
+	}
+	if _, err := DecodeVerify(raw, opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeVerifyMismatch(t *testing.T) {
+	// NaN的payload在json中丢失，重新序列化后不一致
+	var sub []byte
+	sub = protowire.AppendTag(sub, 1, protowire.Fixed32Type)
+	sub = protowire.AppendFixed32(sub, 0x7fc00001)
+	var raw []byte
+	raw = protowire.AppendTag(raw, 1, protowire.VarintType)
+	raw = protowire.AppendVarint(raw, 5)
+	raw = protowire.AppendTag(raw, 3, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, sub)
+
+	_, err := DecodeVerify(raw, Options{"3options": map[string]interface{}{"1": "float"}})
+	if !errors.Is(err, errRoundTripMismatch) {
+		t.Fatalf("got %v, want round trip mismatch", err)
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("got %T, want *DecodeError", err)
+	}
+	if !reflect.DeepEqual(de.Path, []uint64{3, 1}) || de.Offset != 4 {
+		t.Errorf("got path %v offset %d, want path [3 1] offset 4", de.Path, de.Offset)
+	}
+}
@@ -0,0 +1,193 @@
+package pb
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// wktDecoder 解析well-known type，数据不符合该类型的结构时返回false
+type wktDecoder func(data []byte) (interface{}, bool)
+
+var (
+	// wktDecoders well-known type的解析函数，不符合结构时按普通message解析
+	wktDecoders = map[Type]wktDecoder{
+		FieldMask: decodeFieldMask,
+		Timestamp: decodeTimestampWKT,
+		Duration:  decodeDuration,
+	}
+)
+
+const (
+	// minTimestampSeconds Timestamp允许的最小秒数，0001-01-01T00:00:00Z
+	minTimestampSeconds = -62135596800
+	// maxTimestampSeconds Timestamp允许的最大秒数，9999-12-31T23:59:59Z
+	maxTimestampSeconds = 253402300799
+	// nanosPerSecond 每秒的纳秒数
+	nanosPerSecond = 1000000000
+)
+
+// decodeFieldMask 解析google.protobuf.FieldMask，按照proto3的json映射输出为逗号连接的驼峰路径
+// FieldMask只有一个tag为1的repeated string字段
+func decodeFieldMask(data []byte) (interface{}, bool) {
+	paths := []string{}
+	for len(data) > 0 {
+		num, typ, length := protowire.ConsumeTag(data)
+		if length < 0 || num != 1 || typ != protowire.BytesType {
+			return nil, false
+		}
+		data = data[length:]
+		path, length := protowire.ConsumeBytes(data)
+		if length < 0 || !utf8.Valid(path) {
+			return nil, false
+		}
+		data = data[length:]
+		paths = append(paths, lowerCamelPath(string(path)))
+	}
+	return strings.Join(paths, ","), true
+}
+
+// decodeTimestampWKT 解析google.protobuf.Timestamp，输出为UTC的RFC3339时间
+// Timestamp包含tag为1的seconds(int64)和tag为2的nanos(int32)，nanos必须在[0, 1e9)之间
+func decodeTimestampWKT(data []byte) (interface{}, bool) {
+	seconds, nanos, ok := consumeSecondsNanos(data)
+	if !ok || seconds < minTimestampSeconds || seconds > maxTimestampSeconds ||
+		nanos < 0 || nanos >= nanosPerSecond {
+		return nil, false
+	}
+	return time.Unix(seconds, nanos).UTC().Format(time.RFC3339Nano), true
+}
+
+// decodeDuration 解析google.protobuf.Duration，输出为Go的时长字符串，如 1.5s
+// Duration的结构与Timestamp相同，nanos的绝对值小于1e9，且与seconds的符号一致
+// 超出time.Duration表示范围的时长按普通message解析
+func decodeDuration(data []byte) (interface{}, bool) {
+	seconds, nanos, ok := consumeSecondsNanos(data)
+	if !ok || nanos <= -nanosPerSecond || nanos >= nanosPerSecond ||
+		(seconds > 0 && nanos < 0) || (seconds < 0 && nanos > 0) ||
+		seconds > math.MaxInt64/nanosPerSecond-1 || seconds < math.MinInt64/nanosPerSecond+1 {
+		return nil, false
+	}
+	return (time.Duration(seconds)*time.Second + time.Duration(nanos)).String(), true
+}
+
+// consumeSecondsNanos 读取Timestamp和Duration中的seconds和nanos，没有出现的字段为0
+// 出现其它字段或者类型不符时返回false
+func consumeSecondsNanos(data []byte) (seconds, nanos int64, ok bool) {
+	for len(data) > 0 {
+		num, typ, length := protowire.ConsumeTag(data)
+		if length < 0 || typ != protowire.VarintType {
+			return 0, 0, false
+		}
+		data = data[length:]
+		value, length := protowire.ConsumeVarint(data)
+		if length < 0 {
+			return 0, 0, false
+		}
+		data = data[length:]
+		switch num {
+		case 1:
+			seconds = int64(value)
+		case 2:
+			if int64(value) != int64(int32(value)) {
+				return 0, 0, false
+			}
+			nanos = int64(int32(value))
+		default:
+			return 0, 0, false
+		}
+	}
+	return seconds, nanos, true
+}
+
+// lowerCamelPath 将路径中的每一段由下划线格式转换为小驼峰，如 foo_bar.baz_qux 转换为 fooBar.bazQux
+func lowerCamelPath(path string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range path {
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// encodeFieldMask 将逗号连接的驼峰路径序列化为google.protobuf.FieldMask，路径转换回下划线格式
+// 原始路径本身不是下划线格式时无法还原
+func encodeFieldMask(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errInvalidValue
+	}
+	var buf []byte
+	if s == "" {
+		return buf, nil
+	}
+	for _, path := range strings.Split(s, ",") {
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendString(buf, snakePath(path))
+	}
+	return buf, nil
+}
+
+// snakePath 将路径中的每一段由小驼峰转换为下划线格式，是lowerCamelPath的逆操作
+func snakePath(path string) string {
+	var b strings.Builder
+	for _, c := range path {
+		if c >= 'A' && c <= 'Z' {
+			b.WriteByte('_')
+			c += 'a' - 'A'
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// encodeTimestampWKT 将RFC3339时间序列化为google.protobuf.Timestamp，为0的seconds和nanos不输出
+func encodeTimestampWKT(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errInvalidValue
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidValue, err)
+	}
+	return appendSecondsNanos(nil, t.Unix(), int64(t.Nanosecond())), nil
+}
+
+// encodeDuration 将Go的时长字符串序列化为google.protobuf.Duration，nanos与seconds的符号一致
+func encodeDuration(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errInvalidValue
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidValue, err)
+	}
+	return appendSecondsNanos(nil, int64(d/time.Second), int64(d%time.Second)), nil
+}
+
+// appendSecondsNanos 序列化Timestamp和Duration中的seconds和nanos
+func appendSecondsNanos(buf []byte, seconds, nanos int64) []byte {
+	if seconds != 0 {
+		buf = protowire.AppendTag(buf, 1, protowire.VarintType)
+		buf = protowire.AppendVarint(buf, uint64(seconds))
+	}
+	if nanos != 0 {
+		buf = protowire.AppendTag(buf, 2, protowire.VarintType)
+		buf = protowire.AppendVarint(buf, uint64(nanos))
+	}
+	return buf
+}
@@ -0,0 +1,67 @@
+package pb
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestEncodeTimestampDurationRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     string
+		seconds int64
+		nanos   int64
+		want    string
+	}{
+		{"timestamp", "timestamp", 1700000000, 500000000, `{"1_timestamp":"2023-11-14T22:13:20.5Z"}`},
+		{"timestamp seconds only", "timestamp", 1700000000, 0, `{"1_timestamp":"2023-11-14T22:13:20Z"}`},
+		{"duration", "duration", 90, 0, `{"1_duration":"1m30s"}`},
+		{"negative duration", "duration", -1, -500000000, `{"1_duration":"-1.5s"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := protowire.AppendTag(nil, 1, protowire.BytesType)
+			raw = protowire.AppendBytes(raw, appendSecondsNanos(nil, tt.seconds, tt.nanos))
+			js, err := Decode(raw, Options{"1": tt.typ})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if js != tt.want {
+				t.Fatalf("decode got %s, want %s", js, tt.want)
+			}
+			encoded, err := Encode(js)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(encoded, raw) {
+				t.Errorf("encode got %x, want %x", encoded, raw)
+			}
+		})
+	}
+}
+
+func TestEncodeFieldMaskRoundTrip(t *testing.T) {
+	var mask []byte
+	for _, path := range []string{"user.display_name", "photo"} {
+		mask = protowire.AppendTag(mask, 1, protowire.BytesType)
+		mask = protowire.AppendString(mask, path)
+	}
+	raw := protowire.AppendTag(nil, 1, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, mask)
+	js, err := Decode(raw, Options{"1": "fieldmask"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"1_fieldmask":"user.displayName,photo"}`; js != want {
+		t.Fatalf("decode got %s, want %s", js, want)
+	}
+	encoded, err := Encode(js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, raw) {
+		t.Errorf("encode got %x, want %x", encoded, raw)
+	}
+}